@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeleteAccount deactivates the caller's account and schedules it for
+// deletion once the grace period ends. Every session is signed out; signing
+// in again before the deadline cancels the deletion. Accounts without a
+// password call it twice: first to be mailed a code, then with the code.
+func DeleteAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&input); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  http.StatusBadRequest,
+					"message": "Invalid request payload",
+					"error":   err.Error(),
+					"success": false,
+				})
+				return
+			}
+		}
+
+		foundUser, err := queries.GetUserByID(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		// Deletion needs fresh proof of who is asking, so a stolen session
+		// alone cannot destroy the account: the password, or for accounts
+		// without one a code mailed to the account's address.
+		if foundUser.Password != "" {
+			if valid, _ := helpers.VerifyPassword(input.Password, foundUser.Password); !valid {
+				recordFailedAttempt(c, foundUser)
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  http.StatusBadRequest,
+					"message": "Password is incorrect",
+					"success": false,
+				})
+				return
+			}
+		} else if input.Code == "" {
+			code, err := issueOtp(foundUser, models.OtpPurposeDeletion)
+			if err == nil {
+				err = sendOtpEmail(foundUser, mailer.TemplateDeletionCode, code)
+			}
+			if err != nil {
+				log.Printf("Failed to send account deletion code: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  http.StatusInternalServerError,
+					"message": "Failed to send the confirmation code",
+					"success": false,
+				})
+				return
+			}
+
+			c.JSON(http.StatusAccepted, gin.H{
+				"status":  http.StatusAccepted,
+				"message": "We sent a code to your email address. Send it back to confirm the deletion",
+				"data":    gin.H{"codeRequired": true},
+				"success": true,
+			})
+			return
+		} else if !verifyOtp(c, foundUser, models.OtpPurposeDeletion, input.Code) {
+			return
+		}
+
+		scheduledAt := time.Now().Add(helpers.AccountDeletionGracePeriod())
+		if err := queries.ScheduleAccountDeletion(foundUser.ID.Hex(), scheduledAt); err != nil {
+			log.Printf("Failed to schedule account deletion: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to delete account",
+				"success": false,
+			})
+			return
+		}
+
+		if err := queries.RevokeUserRefreshTokens(foundUser.ID.Hex()); err != nil {
+			log.Printf("Failed to revoke refresh tokens: %v", err)
+		}
+		if err := queries.RevokeUserSessions(foundUser.ID.Hex()); err != nil {
+			log.Printf("Failed to revoke sessions: %v", err)
+		}
+
+		go func() {
+			err := mailer.SendTemplate(foundUser.Email, mailer.TemplateDeletion, gin.H{
+				"name": foundUser.FirstName,
+				"date": scheduledAt.UTC().Format("2 January 2006"),
+			})
+			if err != nil {
+				log.Printf("Failed to send account deletion email: %v", err)
+			}
+		}()
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Your account has been deactivated. Sign in before it is deleted to cancel",
+			"data":    gin.H{"deletionScheduledAt": scheduledAt},
+			"success": true,
+		})
+	}
+}
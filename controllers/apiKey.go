@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func CreateAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Name          string   `json:"name" binding:"required"`
+			Scopes        []string `json:"scopes" binding:"required,min=1"`
+			ExpiresInDays int      `json:"expiresInDays" binding:"min=0"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		scopes, ok := validScopes(c, input.Scopes)
+		if !ok {
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		key, prefix, hash, err := helpers.GenerateAPIKey()
+		if err != nil {
+			log.Printf("API key generation error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to create API key",
+				"success": false,
+			})
+			return
+		}
+
+		now := time.Now()
+		apiKey := models.APIKey{
+			ID:        primitive.NewObjectID(),
+			UserID:    userID,
+			Name:      input.Name,
+			Prefix:    prefix,
+			KeyHash:   hash,
+			Scopes:    scopes,
+			CreatedAt: now,
+		}
+		if input.ExpiresInDays > 0 {
+			expiresAt := now.AddDate(0, 0, input.ExpiresInDays)
+			apiKey.ExpiresAt = &expiresAt
+		}
+
+		if err := queries.CreateAPIKey(&apiKey); err != nil {
+			log.Printf("Failed to store API key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to create API key",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "API key created. Copy it now, it will not be shown again",
+			"data": gin.H{
+				"apiKey": apiKey,
+				"key":    key,
+			},
+			"success": true,
+		})
+	}
+}
+
+func GetAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		keys, err := queries.GetAPIKeysByUser(userID)
+		if err != nil {
+			log.Printf("Failed to fetch API keys: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to fetch API keys",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "API keys fetched successfully",
+			"data":    keys,
+			"success": true,
+		})
+	}
+}
+
+func RevokeAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		if err := queries.RevokeAPIKey(userID, c.Param("id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to revoke this API key",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "API key revoked successfully",
+			"success": true,
+		})
+	}
+}
@@ -1,16 +1,15 @@
 package controllers
 
 import (
-	"crypto/rand"
-	"fmt"
+	"errors"
 	"log"
-	"math/big"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 	"udo-golang/helpers"
+	"udo-golang/mailer"
 	"udo-golang/models"
+	"udo-golang/oauth"
 	"udo-golang/queries"
 
 	"github.com/gin-gonic/gin"
@@ -25,7 +24,7 @@ func Signup() gin.HandlerFunc {
 			FirstName string `json:"firstName" binding:"required"`
 			LastName  string `json:"lastName" binding:"required"`
 			Email     string `json:"email" binding:"required,email"`
-			Password  string `json:"password" binding:"required,min=6"`
+			Password  string `json:"password" binding:"required"`
 			IsAdmin   bool   `json:"isAdmin"`
 		}
 
@@ -42,6 +41,10 @@ func Signup() gin.HandlerFunc {
 
 		email := strings.ToLower(input.Email)
 
+		if !checkPasswordPolicy(c, "password", input.Password, input.FirstName, input.LastName, email) {
+			return
+		}
+
 		// Check if email already exists
 		_, err := queries.GetUserByEmail(email)
 		if err == nil {
@@ -77,30 +80,32 @@ func Signup() gin.HandlerFunc {
 			CreatedAt:  time.Now(),
 		}
 
-		// Generate tokens
-		token, refreshToken, err := helpers.GenerateAllTokens(newUser.Email, newUser.ID.Hex(), newUser.IsAdmin)
+		// Insert into DB
+		result, err := queries.CreateNewUser(&newUser)
 		if err != nil {
-			log.Printf("Error generating tokens: %v", err)
+			log.Printf("Error inserting user: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  http.StatusInternalServerError,
-				"message": "Failed to generate tokens",
-				"sucess":  false,
+				"message": "Failed to create user",
+				"success": false,
 			})
 			return
 		}
 
-		// Insert into DB
-		result, err := queries.CreateNewUser(&newUser)
+		// Generate tokens
+		tokens, err := issueTokens(c, &newUser, "")
 		if err != nil {
-			log.Printf("Error inserting user: %v", err)
+			log.Printf("Error generating tokens: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  http.StatusInternalServerError,
-				"message": "Failed to create user",
-				"success": false,
+				"message": "Failed to generate tokens",
+				"sucess":  false,
 			})
 			return
 		}
 
+		sendWelcomeEmail(newUser)
+
 		// Return a safe response (no password)
 		response := gin.H{
 			"id":           newUser.ID,
@@ -110,8 +115,8 @@ func Signup() gin.HandlerFunc {
 			"isAdmin":      newUser.IsAdmin,
 			"isVerified":   newUser.IsVerified,
 			"createdAt":    newUser.CreatedAt,
-			"token":        token,
-			"refreshToken": refreshToken,
+			"token":        tokens.Token,
+			"refreshToken": tokens.RefreshToken,
 			"insertId":     result.InsertedID,
 		}
 
@@ -131,7 +136,7 @@ func RegisterWithOtp() gin.HandlerFunc {
 			FirstName string `json:"firstName" binding:"required"`
 			LastName  string `json:"lastName" binding:"required"`
 			Email     string `json:"email" binding:"required,email"`
-			Password  string `json:"password" binding:"required,min=6"`
+			Password  string `json:"password" binding:"required"`
 			IsAdmin   bool   `json:"isAdmin"`
 		}
 
@@ -148,6 +153,10 @@ func RegisterWithOtp() gin.HandlerFunc {
 
 		email := strings.ToLower(input.Email)
 
+		if !checkPasswordPolicy(c, "password", input.Password, input.FirstName, input.LastName, email) {
+			return
+		}
+
 		_, err := queries.GetUserByEmail(email)
 		if err == nil {
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -170,13 +179,6 @@ func RegisterWithOtp() gin.HandlerFunc {
 			return
 		}
 
-		n, _ := rand.Int(rand.Reader, big.NewInt(1000000))
-		otp := int(n.Int64())
-		otpString := strconv.Itoa(otp)
-		otpExpire := time.Now().Add(5 * time.Minute)
-		fmt.Println(otp)
-		fmt.Println(otpExpire)
-
 		// // Create new user model
 		newUser := models.User{
 			ID:         primitive.NewObjectID(),
@@ -187,13 +189,10 @@ func RegisterWithOtp() gin.HandlerFunc {
 			IsAdmin:    input.IsAdmin,
 			IsVerified: false,
 			CreatedAt:  time.Now(),
-			Otp:        &otpString,
-			OtpExpire:  &otpExpire,
 		}
 
 		// Insert into DB
-		result, err := queries.CreateNewUser(&newUser)
-		if err != nil {
+		if _, err := queries.CreateNewUser(&newUser); err != nil {
 			log.Printf("Error inserting user: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  http.StatusInternalServerError,
@@ -203,136 +202,82 @@ func RegisterWithOtp() gin.HandlerFunc {
 			return
 		}
 
-		fmt.Println(result)
+		otpString, err := issueOtp(&newUser, models.OtpPurposeVerify)
+		if err != nil {
+			log.Printf("Error generating OTP: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to generate OTP",
+				"success": false,
+			})
+			return
+		}
 
-		message := "An OTP has been sent to your email address for account verification " + otpString
+		if err := sendOtpEmail(&newUser, mailer.TemplateVerification, otpString); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to send OTP email",
+				"success": false,
+			})
+			return
+		}
 
 		c.JSON(http.StatusCreated, gin.H{
 			"status":  http.StatusCreated,
-			"message": message,
+			"message": "An OTP has been sent to your email address for account verification",
 			"success": true,
 		})
 	}
 }
 
+// GoogleSignUpandSignIn signs a user in with a Google ID token, creating the
+// account on first use. The token is verified offline against Google's keys.
 func GoogleSignUpandSignIn() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		accessToken := c.Query("access_token")
-		if accessToken == "" {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  http.StatusBadRequest,
-				"message": "Access token is required",
-				"success": false,
-			})
-			return
+		var input struct {
+			IDToken string `json:"idToken" binding:"required"`
 		}
 
-		userInfo, err := queries.GetGoogleUserInfo(accessToken)
-		if err != nil {
+		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
-				"message": "Error fetching Google user info",
+				"message": "Invalid request payload",
 				"error":   err.Error(),
 				"success": false,
 			})
 			return
 		}
 
-		email, _ := userInfo["email"].(string)
-		id, _ := userInfo["id"].(string)
-		name, _ := userInfo["name"].(string)
-
-		parts := strings.Fields(name)
-
-		firstName := ""
-		lastName := ""
-
-		if len(parts) > 0 {
-			firstName = parts[0]
-		}
-		if len(parts) > 1 {
-			lastName = parts[len(parts)-1]
-		}
-
-		if email == "" {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  http.StatusBadRequest,
-				"message": "Email not found in Google profile",
-				"success": false,
-			})
-			return
-		}
-
-		signedToken, err := helpers.SignJWt(email, id, false)
+		claims, err := helpers.VerifyGoogleIDToken(input.IDToken)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  http.StatusInternalServerError,
-				"message": "Error generating token",
-				"error":   err.Error(),
+			log.Printf("Google ID token rejected: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Invalid Google ID token",
 				"success": false,
 			})
 			return
 		}
 
-		foundUser, err := queries.GetUserByEmail(email)
-		if err == nil {
-			now := time.Now()
-			if err := queries.UpdateUser(foundUser.ID.Hex(), bson.M{"lastLogin": &now}); err != nil {
-				log.Printf("Failed to update last login: %v", err)
+		firstName, lastName := claims.GivenName, claims.FamilyName
+		if firstName == "" {
+			parts := strings.Fields(claims.Name)
+			if len(parts) > 0 {
+				firstName = parts[0]
 			}
-
-			response := gin.H{
-				"id":         foundUser.ID,
-				"firstName":  foundUser.FirstName,
-				"lastName":   foundUser.LastName,
-				"email":      foundUser.Email,
-				"isAdmin":    foundUser.IsAdmin,
-				"isVerified": foundUser.IsVerified,
-				"lastLogin":  now,
-				"token":      signedToken,
+			if len(parts) > 1 {
+				lastName = parts[len(parts)-1]
 			}
-
-			c.JSON(http.StatusOK, gin.H{
-				"status":  http.StatusOK,
-				"message": "Login successful",
-				"data":    response,
-				"success": true,
-			})
-			return
 		}
 
-		newUser := models.User{
-			ID:         primitive.NewObjectID(),
-			FirstName:  firstName,
-			LastName:   lastName,
-			Email:      email,
-			Password:   "",
-			IsAdmin:    false,
-			IsVerified: true,
-			CreatedAt:  time.Now(),
-		}
-
-		result, err := queries.CreateNewUser(&newUser)
-		if err != nil {
-			log.Printf("Error inserting user: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  http.StatusInternalServerError,
-				"message": "Failed to create user",
-				"success": false,
-			})
-			return
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"status":  http.StatusOK,
-			"message": "User Created Successful",
-			"data": gin.H{
-				"id":    result.InsertedID,
-				"name":  name,
-				"email": email,
-				"token": signedToken,
-			},
-			"success": true,
+		signInWithProfile(c, &oauth.Profile{
+			Provider:      "google",
+			Subject:       claims.Subject,
+			Email:         strings.ToLower(claims.Email),
+			EmailVerified: bool(claims.EmailVerified),
+			FirstName:     firstName,
+			LastName:      lastName,
 		})
 	}
 }
@@ -358,6 +303,10 @@ func VerifyAccount() gin.HandlerFunc {
 
 		foundUser, err := queries.GetUserByEmail(email)
 		if err != nil {
+			if !attemptAllowed(c, nil) {
+				return
+			}
+			recordFailedAttempt(c, nil)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
 				"message": "User account does not exist",
@@ -366,29 +315,16 @@ func VerifyAccount() gin.HandlerFunc {
 			return
 		}
 
-		if foundUser.Otp == nil || *foundUser.Otp != input.Otp {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  http.StatusBadRequest,
-				"message": "Invalid OTP",
-				"success": false,
-			})
+		if !attemptAllowed(c, foundUser) {
 			return
 		}
 
-		if foundUser.OtpExpire == nil || time.Now().After(*foundUser.OtpExpire) {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  http.StatusBadRequest,
-				"message": "OTP has expired",
-				"success": false,
-			})
+		if !verifyOtp(c, foundUser, models.OtpPurposeVerify, input.Otp) {
 			return
 		}
 
-		updateData := bson.M{
-			"isVerified": true,
-			"otp":        nil,
-			"otpExpire":  nil,
-		}
+		updateData := lockoutReset()
+		updateData["isVerified"] = true
 
 		if err := queries.UpdateUser(foundUser.ID.Hex(), updateData); err != nil {
 			log.Printf("Failed to verify account: %v", err)
@@ -400,6 +336,8 @@ func VerifyAccount() gin.HandlerFunc {
 			return
 		}
 
+		sendWelcomeEmail(*foundUser)
+
 		response := gin.H{
 			"id":         foundUser.ID,
 			"firstName":  foundUser.FirstName,
@@ -418,7 +356,11 @@ func VerifyAccount() gin.HandlerFunc {
 	}
 }
 
-func SendOtp() gin.HandlerFunc {
+// SendOtp mails a fresh OTP for the given purpose, either
+// models.OtpPurposeVerify or models.OtpPurposeReset.
+func SendOtp(purpose string) gin.HandlerFunc {
+	template := otpTemplates[purpose]
+
 	return func(c *gin.Context) {
 		var input struct {
 			Email string `json:"email" binding:"required,email"`
@@ -449,20 +391,19 @@ func SendOtp() gin.HandlerFunc {
 			return
 		}
 
-		n, _ := rand.Int(rand.Reader, big.NewInt(1000000))
-		otp := int(n.Int64())
-		otpString := strconv.Itoa(otp)
-		otpExpire := time.Now().Add(5 * time.Minute)
-		fmt.Println(otp)
-		fmt.Println(otpExpire)
-
-		update := bson.M{
-			"otp":       otpString,
-			"otpExpire": otpExpire,
+		otpString, err := issueOtp(foundUser, purpose)
+		if err != nil {
+			log.Printf("Error generating OTP: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to resend OTP",
+				"success": false,
+			})
+			return
 		}
 
-		if err := queries.UpdateUser(foundUser.ID.Hex(), update); err != nil {
-			log.Printf("Failed to update OTP: %v", err)
+		if err := sendOtpEmail(foundUser, template, otpString); err != nil {
+			log.Printf("Failed to send OTP email: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  http.StatusInternalServerError,
 				"message": "Failed to resend OTP",
@@ -471,11 +412,9 @@ func SendOtp() gin.HandlerFunc {
 			return
 		}
 
-		message := "An OTP has been sent to your email address for account verification " + otpString
-
 		c.JSON(http.StatusCreated, gin.H{
 			"status":  http.StatusCreated,
-			"message": message,
+			"message": "An OTP has been sent to your email address",
 			"success": true,
 		})
 	}
@@ -503,6 +442,10 @@ func Login() gin.HandlerFunc {
 		foundUser, err := queries.GetUserByEmail(email)
 		if err != nil {
 			log.Printf("Login error (find): %v", err)
+			if !attemptAllowed(c, nil) {
+				return
+			}
+			recordFailedAttempt(c, nil)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
 				"message": "Invalid email or password",
@@ -511,8 +454,13 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
+		if !attemptAllowed(c, foundUser) {
+			return
+		}
+
 		passwordIsValid, msg := helpers.VerifyPassword(loginRequest.Password, foundUser.Password)
 		if !passwordIsValid {
+			recordFailedAttempt(c, foundUser)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
 				"message": msg,
@@ -521,6 +469,8 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
+		rehashPassword(foundUser, loginRequest.Password)
+
 		if !foundUser.IsVerified {
 			c.JSON(http.StatusForbidden, gin.H{
 				"status":  http.StatusForbidden,
@@ -530,7 +480,91 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
-		token, refreshToken, err := helpers.GenerateAllTokens(foundUser.Email, foundUser.ID.Hex(), foundUser.IsAdmin)
+		if requireMfa(c, foundUser) {
+			return
+		}
+
+		completeLogin(c, foundUser)
+	}
+}
+
+func RefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			RefreshToken string `json:"refreshToken" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		claims, msg := helpers.ValidateRefreshToken(input.RefreshToken)
+		if msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": msg,
+				"success": false,
+			})
+			return
+		}
+
+		// Each refresh token may only be exchanged once. Presenting one that
+		// was already used means it has leaked, so the whole session goes,
+		// including access tokens already issued from it.
+		_, err := queries.ConsumeRefreshToken(claims.Id)
+		if errors.Is(err, queries.ErrRefreshTokenReused) {
+			log.Printf("Refresh token reuse detected for user %s (family %s)", claims.ID, claims.Family)
+			userID, _ := primitive.ObjectIDFromHex(claims.ID)
+			if err := queries.RevokeSession(userID, claims.Family); err != nil {
+				log.Printf("Failed to revoke session: %v", err)
+				// Families issued before sessions existed have no session
+				// record, but their refresh tokens must still go.
+				if err := queries.RevokeRefreshTokenFamily(claims.Family); err != nil {
+					log.Printf("Failed to revoke refresh token family: %v", err)
+				}
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Refresh token has already been used, please log in again",
+				"success": false,
+			})
+			return
+		}
+		if errors.Is(err, queries.ErrRefreshTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Token has been revoked",
+				"success": false,
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Refresh token error (consume): %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "The refresh token is invalid",
+				"success": false,
+			})
+			return
+		}
+
+		foundUser, err := queries.GetUserByID(claims.ID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		tokens, err := issueTokens(c, foundUser, claims.Family)
 		if err != nil {
 			log.Printf("Token generation error: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -541,27 +575,99 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
-		now := time.Now()
-		if err := queries.UpdateUser(foundUser.ID.Hex(), bson.M{"lastLogin": &now}); err != nil {
-			log.Printf("Failed to update last login: %v", err)
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Token refreshed successfully",
+			"data": gin.H{
+				"token":        tokens.Token,
+				"refreshToken": tokens.RefreshToken,
+			},
+			"success": true,
+		})
+	}
+}
+
+func Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			RefreshToken string `json:"refreshToken"`
+		}
+
+		// The body is optional; without it only the access token is revoked.
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&input); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  http.StatusBadRequest,
+					"message": "Invalid request payload",
+					"error":   err.Error(),
+					"success": false,
+				})
+				return
+			}
 		}
 
-		response := gin.H{
-			"id":           foundUser.ID,
-			"firstName":    foundUser.FirstName,
-			"lastName":     foundUser.LastName,
-			"email":        foundUser.Email,
-			"isAdmin":      foundUser.IsAdmin,
-			"isVerified":   foundUser.IsVerified,
-			"lastLogin":    now,
-			"token":        token,
-			"refreshToken": refreshToken,
+		claims := c.MustGet("claims").(*helpers.SignedDetails)
+
+		if claims.Id != "" {
+			if err := queries.RevokeToken(claims.Id, claims.ID, time.Unix(claims.ExpiresAt, 0)); err != nil {
+				log.Printf("Failed to revoke access token: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  http.StatusInternalServerError,
+					"message": "Failed to log out",
+					"success": false,
+				})
+				return
+			}
+		}
+
+		if claims.Session != "" {
+			userID, _ := primitive.ObjectIDFromHex(claims.ID)
+			if err := queries.RevokeSession(userID, claims.Session); err != nil {
+				log.Printf("Failed to revoke session: %v", err)
+			}
+		}
+
+		if input.RefreshToken != "" {
+			refreshClaims, msg := helpers.ValidateRefreshToken(input.RefreshToken)
+			if msg == "" && refreshClaims.ID == claims.ID {
+				if err := queries.RevokeRefreshTokenFamily(refreshClaims.Family); err != nil {
+					log.Printf("Failed to revoke refresh token family: %v", err)
+				}
+			}
 		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"status":  http.StatusOK,
-			"message": "Login successful",
-			"data":    response,
+			"message": "Logout successful",
+			"success": true,
+		})
+	}
+}
+
+func LogoutAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("id")
+
+		if err := queries.IncrementTokenVersion(userID); err != nil {
+			log.Printf("Failed to update token version: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to log out of all sessions",
+				"success": false,
+			})
+			return
+		}
+
+		if err := queries.RevokeUserRefreshTokens(userID); err != nil {
+			log.Printf("Failed to revoke refresh tokens: %v", err)
+		}
+		if err := queries.RevokeUserSessions(userID); err != nil {
+			log.Printf("Failed to revoke sessions: %v", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Logged out of all sessions",
 			"success": true,
 		})
 	}
@@ -590,6 +696,10 @@ func ResetPassword() gin.HandlerFunc {
 
 		foundUser, err := queries.GetUserByEmail(email)
 		if err != nil {
+			if !attemptAllowed(c, nil) {
+				return
+			}
+			recordFailedAttempt(c, nil)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
 				"message": "User account does not exist",
@@ -598,30 +708,15 @@ func ResetPassword() gin.HandlerFunc {
 			return
 		}
 
-		if foundUser.Otp == nil || *foundUser.Otp != input.Otp {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  http.StatusBadRequest,
-				"message": "Invalid OTP",
-				"success": false,
-			})
+		if !attemptAllowed(c, foundUser) {
 			return
 		}
 
-		if foundUser.OtpExpire == nil || time.Now().After(*foundUser.OtpExpire) {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  http.StatusBadRequest,
-				"message": "OTP has expired",
-				"success": false,
-			})
+		if !checkPasswordPolicy(c, "password", input.Password, foundUser.FirstName, foundUser.LastName, foundUser.Email) {
 			return
 		}
 
-		if len(input.Password) < 6 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"status":  http.StatusBadRequest,
-				"message": "Password must be at least 6 characters",
-				"success": false,
-			})
+		if !checkPasswordHistory(c, "password", foundUser, input.Password) {
 			return
 		}
 
@@ -634,6 +729,11 @@ func ResetPassword() gin.HandlerFunc {
 			return
 		}
 
+		// The code is only spent once the new password is acceptable.
+		if !verifyOtp(c, foundUser, models.OtpPurposeReset, input.Otp) {
+			return
+		}
+
 		hashedPassword, err := helpers.HashPassword(input.Password)
 		if err != nil {
 			log.Printf("Error hashing password: %v", err)
@@ -645,15 +745,14 @@ func ResetPassword() gin.HandlerFunc {
 			return
 		}
 
-		updateData := bson.M{
-			"isVerified": true,
-			"otp":        nil,
-			"otpExpire":  nil,
-			"updatedAt":  time.Now(),
-			"password":   hashedPassword,
-		}
+		// A valid reset OTP proves control of the mailbox, so it also lifts
+		// any lockout on the account.
+		updateData := lockoutReset()
+		updateData["isVerified"] = true
+		updateData["updatedAt"] = time.Now()
 
-		if err := queries.UpdateUser(foundUser.ID.Hex(), updateData); err != nil {
+		historySize := helpers.GetPasswordPolicy().HistorySize
+		if err := queries.UpdatePassword(foundUser.ID.Hex(), foundUser.Password, hashedPassword, historySize, updateData); err != nil {
 			log.Printf("Failed to verify account: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  http.StatusInternalServerError,
@@ -690,9 +789,7 @@ func ChangePassword() gin.HandlerFunc {
 			return
 		}
 
-		email := strings.ToLower(input.Email)
-
-		foundUser, err := queries.GetUserByEmail(email)
+		foundUser, err := queries.GetUserByID(c.GetString("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
@@ -702,25 +799,35 @@ func ChangePassword() gin.HandlerFunc {
 			return
 		}
 
-		passwordIsValid, _ := helpers.VerifyPassword(input.OldPassword, foundUser.Password)
-		if !passwordIsValid {
+		// The account comes from the session; the email in the body is only
+		// a confirmation and must name the same account.
+		if strings.ToLower(input.Email) != foundUser.Email {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
-				"message": "Old Password is incorrect",
+				"message": "Email does not match the signed-in account",
 				"success": false,
 			})
 			return
 		}
 
-		if len(input.NewPassword) < 6 {
+		passwordIsValid, _ := helpers.VerifyPassword(input.OldPassword, foundUser.Password)
+		if !passwordIsValid {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
-				"message": "Password must be at least 6 characters",
+				"message": "Old Password is incorrect",
 				"success": false,
 			})
 			return
 		}
 
+		if !checkPasswordPolicy(c, "newPassword", input.NewPassword, foundUser.FirstName, foundUser.LastName, foundUser.Email) {
+			return
+		}
+
+		if !checkPasswordHistory(c, "newPassword", foundUser, input.NewPassword) {
+			return
+		}
+
 		if input.NewPassword != input.ConfirmNewPassword {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
@@ -743,10 +850,10 @@ func ChangePassword() gin.HandlerFunc {
 
 		updateData := bson.M{
 			"updatedAt": time.Now(),
-			"password":  hashedPassword,
 		}
 
-		if err := queries.UpdateUser(foundUser.ID.Hex(), updateData); err != nil {
+		historySize := helpers.GetPasswordPolicy().HistorySize
+		if err := queries.UpdatePassword(foundUser.ID.Hex(), foundUser.Password, hashedPassword, historySize, updateData); err != nil {
 			log.Printf("Failed to verify account: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  http.StatusInternalServerError,
@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// dataExportLinkTTL caps the lifetime of the signed download link returned
+// by the status endpoints. The emailed link carries a random token stored
+// with the export instead, so it lasts as long as the export itself without
+// depending on the signing key outliving its retention.
+const dataExportLinkTTL = 15 * time.Minute
+
+func dataExportURL(export *models.DataExport, token string) string {
+	return fmt.Sprintf("%s/auth/data-exports/%s/download?token=%s",
+		strings.TrimRight(os.Getenv("APP_URL"), "/"), export.ID.Hex(), url.QueryEscape(token))
+}
+
+// buildDataExport collects everything stored about user into a ZIP archive
+// with one JSON file per kind of record.
+func buildDataExport(user *models.User) ([]byte, error) {
+	sessions, err := queries.GetSessionsByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	logins, err := queries.GetLoginEventsByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := queries.GetIdentitiesByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	passkeys, err := queries.GetWebauthnCredentialsByUser(user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := queries.GetAPIKeysByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	auditEvents, err := queries.GetAuditEventsByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"sessions.json", sessions},
+		{"login-history.json", logins},
+		{"identities.json", identities},
+		{"passkeys.json", passkeys},
+		{"api-keys.json", apiKeys},
+		{"audit-events.json", auditEvents},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// generateDataExport builds the archive for export in the background and
+// mails the user a download link once it is ready.
+func generateDataExport(user *models.User, export *models.DataExport) {
+	go func() {
+		token := helpers.NewTokenID()
+		archive, err := buildDataExport(user)
+		if err == nil {
+			err = queries.CompleteDataExport(export, archive, hashNonce(token))
+		}
+		if errors.Is(err, queries.ErrDataExportNotPending) {
+			log.Printf("Data export %s was given up on before it finished", export.ID.Hex())
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to build data export %s: %v", export.ID.Hex(), err)
+			if err := queries.FailDataExport(export.ID); err != nil {
+				log.Printf("Failed to mark data export as failed: %v", err)
+			}
+			return
+		}
+
+		err = mailer.SendTemplate(user.Email, mailer.TemplateDataExport, gin.H{
+			"name":      user.FirstName,
+			"link":      dataExportURL(export, token),
+			"expiresAt": export.ExpiresAt.UTC().Format("2 January 2006 at 15:04 UTC"),
+		})
+		if err != nil {
+			log.Printf("Failed to send data export email: %v", err)
+		}
+	}()
+}
+
+// startDataExport queues an export of userID's data requested by requestedBy,
+// who is either the user or an admin acting for them.
+func startDataExport(c *gin.Context, userID string, requestedBy string) {
+	user, err := queries.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "User does not exist",
+			"success": false,
+		})
+		return
+	}
+
+	requester, err := primitive.ObjectIDFromHex(requestedBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "User account does not exist",
+			"success": false,
+		})
+		return
+	}
+
+	pending, err := queries.HasPendingDataExport(user.ID, time.Now().Add(-helpers.DataExportBuildTimeout()))
+	if err != nil {
+		log.Printf("Failed to check data exports: %v", err)
+	}
+	if pending {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  http.StatusConflict,
+			"message": "An export is already being prepared",
+			"success": false,
+		})
+		return
+	}
+
+	now := time.Now()
+	export := models.DataExport{
+		ID:           primitive.NewObjectID(),
+		UserID:       user.ID,
+		RequestedBy:  requester,
+		Status:       models.DataExportPending,
+		TokenVersion: user.TokenVersion,
+		ExpiresAt:    now.Add(helpers.DataExportTTL()),
+		CreatedAt:    now,
+	}
+
+	if err := queries.CreateDataExport(&export); err != nil {
+		log.Printf("Failed to create data export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Failed to start the export",
+			"success": false,
+		})
+		return
+	}
+
+	event := models.AuditEvent{
+		ID:        primitive.NewObjectID(),
+		Action:    models.AuditDataExport,
+		UserID:    user.ID,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		CreatedAt: now,
+	}
+	if requester != user.ID {
+		event.ActorID = &requester
+	}
+	if err := queries.CreateAuditEvent(&event); err != nil {
+		log.Printf("Failed to record data export: %v", err)
+	}
+
+	generateDataExport(user, &export)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  http.StatusAccepted,
+		"message": "Your export is being prepared. We will email a download link when it is ready",
+		"data":    export,
+		"success": true,
+	})
+}
+
+// showDataExport responds with the status of an export and, once it is
+// ready, a short-lived download link.
+func showDataExport(c *gin.Context, userID string, exportID string) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "User does not exist",
+			"success": false,
+		})
+		return
+	}
+
+	export, err := queries.GetDataExport(objID, exportID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  http.StatusNotFound,
+			"message": "Export not found",
+			"success": false,
+		})
+		return
+	}
+
+	data := gin.H{"export": export}
+	if export.Status == models.DataExportReady {
+		user, err := queries.GetUserByID(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		expiresAt := time.Now().Add(dataExportLinkTTL)
+		if export.ExpiresAt.Before(expiresAt) {
+			expiresAt = export.ExpiresAt
+		}
+
+		token, err := helpers.GenerateDataExportToken(userID, user.TokenVersion, exportID, expiresAt)
+		if err != nil {
+			log.Printf("Failed to sign data export link: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to create a download link",
+				"success": false,
+			})
+			return
+		}
+		data["downloadUrl"] = dataExportURL(export, token)
+		data["downloadUrlExpiresAt"] = expiresAt
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"message": "Export fetched successfully",
+		"data":    data,
+		"success": true,
+	})
+}
+
+func RequestDataExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startDataExport(c, c.GetString("id"), c.GetString("id"))
+	}
+}
+
+func RequestUserDataExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startDataExport(c, c.Param("id"), c.GetString("id"))
+	}
+}
+
+func GetDataExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		showDataExport(c, c.GetString("id"), c.Param("id"))
+	}
+}
+
+func GetUserDataExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		showDataExport(c, c.Param("id"), c.Param("exportId"))
+	}
+}
+
+// findDownloadableExport resolves a download link's token: the random
+// token from the emailed link, or a signed one from the status endpoints.
+func findDownloadableExport(exportID string, token string) (*models.DataExport, bool) {
+	if token == "" {
+		return nil, false
+	}
+
+	if export, err := queries.GetReadyDataExportByToken(exportID, hashNonce(token)); err == nil {
+		user, err := queries.GetUserByID(export.UserID.Hex())
+		if err != nil || user.TokenVersion != export.TokenVersion {
+			return nil, false
+		}
+		return export, true
+	}
+
+	claims, msg := helpers.ValidateDataExportToken(token)
+	if msg != "" || claims.Id != exportID {
+		return nil, false
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.ID)
+	if err != nil {
+		return nil, false
+	}
+	export, err := queries.GetReadyDataExport(userID, claims.Id)
+	if err != nil {
+		return nil, false
+	}
+	return export, true
+}
+
+// DownloadDataExport serves a finished export to anyone holding a valid
+// download link; the link's token is the only credential.
+func DownloadDataExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		export, ok := findDownloadableExport(c.Param("id"), c.Query("token"))
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "The download link is invalid or has expired",
+				"success": false,
+			})
+			return
+		}
+
+		archive, err := queries.OpenDataExportArchive(export.ID)
+		if err != nil {
+			log.Printf("Failed to open data export %s: %v", export.ID.Hex(), err)
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Export not found",
+				"success": false,
+			})
+			return
+		}
+		defer archive.Close()
+
+		filename := fmt.Sprintf("data-export-%s.zip", export.CreatedAt.UTC().Format("2006-01-02"))
+		c.Header("Cache-Control", "no-store")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.DataFromReader(http.StatusOK, archive.GetFile().Length, "application/zip", archive, nil)
+	}
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"log"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
+	"udo-golang/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendOtpEmail mails code to user using the verification or reset template.
+// The code itself must never be logged or returned to the caller.
+func sendOtpEmail(user *models.User, template string, code string) error {
+	return mailer.SendTemplate(user.Email, template, gin.H{
+		"name":      user.FirstName,
+		"code":      code,
+		"expiresIn": int(helpers.OtpTTL.Minutes()),
+	})
+}
+
+// sendWelcomeEmail is best effort; a failure is logged and otherwise ignored.
+func sendWelcomeEmail(user models.User) {
+	go func() {
+		if err := mailer.SendTemplate(user.Email, mailer.TemplateWelcome, gin.H{"name": user.FirstName}); err != nil {
+			log.Printf("Failed to send welcome email: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RequestEmailChange starts moving the account to a new address. It mails a
+// code to the new address and a notice to the current one; nothing changes
+// until ConfirmEmailChange receives the code.
+func RequestEmailChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			NewEmail string `json:"newEmail" binding:"required,email"`
+			Password string `json:"password"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		foundUser, err := queries.GetUserByID(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		// Accounts with a password must re-enter it, so a stolen session
+		// alone cannot take over the account.
+		if foundUser.Password != "" {
+			if valid, _ := helpers.VerifyPassword(input.Password, foundUser.Password); !valid {
+				recordFailedAttempt(c, foundUser)
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  http.StatusBadRequest,
+					"message": "Password is incorrect",
+					"success": false,
+				})
+				return
+			}
+		}
+
+		newEmail := strings.ToLower(input.NewEmail)
+		if newEmail == foundUser.Email {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "This is already your email address",
+				"success": false,
+			})
+			return
+		}
+
+		if _, err := queries.GetUserByEmail(newEmail); err == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  http.StatusConflict,
+				"message": "Email is already in use",
+				"success": false,
+			})
+			return
+		}
+
+		// The code is bound to the address it is mailed to, so it can only
+		// confirm the change it was sent for even if pendingEmail is
+		// replaced by a later request in the meantime.
+		code, err := issueOtpTo(foundUser, models.OtpPurposeEmailChange, newEmail)
+		if err == nil {
+			err = queries.UpdateUser(foundUser.ID.Hex(), bson.M{"pendingEmail": newEmail, "updatedAt": time.Now()})
+		}
+		if err != nil {
+			log.Printf("Failed to start email change: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start the email change",
+				"success": false,
+			})
+			return
+		}
+
+		err = mailer.SendTemplate(newEmail, mailer.TemplateEmailChange, gin.H{
+			"name":      foundUser.FirstName,
+			"code":      code,
+			"expiresIn": int(helpers.OtpTTL.Minutes()),
+		})
+		if err != nil {
+			log.Printf("Failed to send email change code: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to send the confirmation code",
+				"success": false,
+			})
+			return
+		}
+
+		go func() {
+			err := mailer.SendTemplate(foundUser.Email, mailer.TemplateEmailNotice, gin.H{
+				"name":     foundUser.FirstName,
+				"newEmail": newEmail,
+			})
+			if err != nil {
+				log.Printf("Failed to send email change notice: %v", err)
+			}
+		}()
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "We sent a code to your new email address",
+			"success": true,
+		})
+	}
+}
+
+func ConfirmEmailChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		foundUser, err := queries.GetUserByID(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		if foundUser.PendingEmail == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "There is no email change to confirm",
+				"success": false,
+			})
+			return
+		}
+
+		if !verifyOtpFor(c, foundUser, models.OtpPurposeEmailChange, input.Code, foundUser.PendingEmail) {
+			return
+		}
+
+		err = queries.ConfirmEmailChange(foundUser.ID.Hex(), foundUser.PendingEmail)
+		if errors.Is(err, queries.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  http.StatusConflict,
+				"message": "Email is already in use",
+				"success": false,
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to change email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to change email",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Email changed successfully",
+			"data":    gin.H{"email": foundUser.PendingEmail},
+			"success": true,
+		})
+	}
+}
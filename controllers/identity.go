@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/oauth"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// loginMethodCount counts the ways user can still sign in: a password,
+// passkeys and linked identities. Magic links are left out because they
+// only work for an address the user already proved with one of these.
+func loginMethodCount(user *models.User) (int, error) {
+	count := 0
+	if user.Password != "" {
+		count++
+	}
+
+	passkeys, err := queries.GetWebauthnCredentialsByUser(user.ID.Hex())
+	if err != nil {
+		return 0, err
+	}
+	count += len(passkeys)
+
+	identities, err := queries.GetIdentitiesByUser(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	count += len(identities)
+
+	return count, nil
+}
+
+// linkProfile attaches an external account to the signed-in user.
+func linkProfile(c *gin.Context, userID primitive.ObjectID, profile *oauth.Profile) {
+	if profile.Subject == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "The provider did not identify the account",
+			"success": false,
+		})
+		return
+	}
+
+	if identity, err := queries.GetIdentity(profile.Provider, profile.Subject); err == nil {
+		if identity.UserID == userID {
+			c.JSON(http.StatusOK, gin.H{
+				"status":  http.StatusOK,
+				"message": "This account is already linked",
+				"data":    identity,
+				"success": true,
+			})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  http.StatusConflict,
+			"message": "This account is linked to another user",
+			"success": false,
+		})
+		return
+	}
+
+	if err := createIdentity(userID, profile); err != nil {
+		if errors.Is(err, queries.ErrIdentityLinked) {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  http.StatusConflict,
+				"message": "This account is linked to another user",
+				"success": false,
+			})
+			return
+		}
+		log.Printf("Failed to link identity: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Failed to link account",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"message": "Account linked successfully",
+		"success": true,
+	})
+}
+
+// LinkIdentity starts linking a provider to the signed-in user. It answers
+// with the authorization URL to send the browser to; the provider's callback
+// completes the link. Google can also be linked directly with an ID token.
+func LinkIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		var input struct {
+			IDToken string `json:"idToken"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		name := c.Param("provider")
+		if name == "google" && input.IDToken != "" {
+			claims, err := helpers.VerifyGoogleIDToken(input.IDToken)
+			if err != nil {
+				log.Printf("Google ID token rejected: %v", err)
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"status":  http.StatusUnauthorized,
+					"message": "Invalid Google ID token",
+					"success": false,
+				})
+				return
+			}
+			linkProfile(c, userID, &oauth.Profile{
+				Provider:      "google",
+				Subject:       claims.Subject,
+				Email:         strings.ToLower(claims.Email),
+				EmailVerified: bool(claims.EmailVerified),
+			})
+			return
+		}
+
+		provider, ok := oauth.Get(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Unknown sign-in provider",
+				"success": false,
+			})
+			return
+		}
+
+		authURL, ok := beginOAuth(c, provider, &userID)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Continue linking at the provider",
+			"data": gin.H{
+				"authorizationUrl": authURL,
+			},
+			"success": true,
+		})
+	}
+}
+
+func GetIdentities() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		identities, err := queries.GetIdentitiesByUser(userID)
+		if err != nil {
+			log.Printf("Failed to fetch identities: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to fetch linked accounts",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Linked accounts fetched successfully",
+			"data":    identities,
+			"success": true,
+		})
+	}
+}
+
+// requireOtherLoginMethod refuses to remove a login method when it is the
+// user's last one. It reports whether removal may go ahead.
+func requireOtherLoginMethod(c *gin.Context, user *models.User) bool {
+	count, err := loginMethodCount(user)
+	if err != nil {
+		log.Printf("Failed to count login methods: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Unable to check your other sign-in methods",
+			"success": false,
+		})
+		return false
+	}
+
+	if count <= 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "You cannot remove your last sign-in method. Set a password or add another sign-in method first",
+			"success": false,
+		})
+		return false
+	}
+
+	return true
+}
+
+func UnlinkIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		foundUser, err := queries.GetUserByID(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		if !requireOtherLoginMethod(c, foundUser) {
+			return
+		}
+
+		if err := queries.DeleteIdentity(foundUser.ID, c.Param("id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to unlink this account",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Account unlinked successfully",
+			"success": true,
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ImpersonateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Reason string `json:"reason" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		admin, err := queries.GetUserByID(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		user, err := queries.GetUserByID(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		// An impersonation token never carries admin rights.
+		if user.IsAdmin || user.ID == admin.ID {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  http.StatusForbidden,
+				"message": "Admin accounts cannot be impersonated",
+				"success": false,
+			})
+			return
+		}
+
+		token, claims, err := helpers.GenerateImpersonationToken(user, admin)
+		if err != nil {
+			log.Printf("Failed to sign impersonation token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start impersonation",
+				"success": false,
+			})
+			return
+		}
+
+		// Without a record of who started it, the session must not exist.
+		err = queries.CreateAuditEvent(&models.AuditEvent{
+			ID:        primitive.NewObjectID(),
+			Action:    models.AuditImpersonationStart,
+			UserID:    user.ID,
+			ActorID:   &admin.ID,
+			Reason:    input.Reason,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			log.Printf("Failed to record impersonation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start impersonation",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Impersonation started",
+			"data": gin.H{
+				"token":     token,
+				"expiresAt": time.Unix(claims.ExpiresAt, 0),
+				"user":      user,
+			},
+			"success": true,
+		})
+	}
+}
+
+func GetAuditEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, pageSize := helpers.ExtractPagination(c, 20)
+
+		filter := bson.M{}
+		for _, field := range []string{"userId", "actorId"} {
+			if value := c.Query(field); value != "" {
+				id, err := primitive.ObjectIDFromHex(value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"status":  http.StatusBadRequest,
+						"message": "Invalid " + field,
+						"success": false,
+					})
+					return
+				}
+				filter[field] = id
+			}
+		}
+		if action := c.Query("action"); action != "" {
+			filter["action"] = action
+		}
+
+		events, err := queries.GetAuditEvents(page, pageSize, filter)
+		if err != nil {
+			log.Printf("Failed to fetch audit events: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to fetch audit events",
+				"success": false,
+			})
+			return
+		}
+
+		total, _ := queries.GetAuditEventCount(filter)
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":   http.StatusOK,
+			"message":  "Audit events fetched successfully",
+			"data":     events,
+			"metaData": helpers.CreatePaginationResponse(page, pageSize, total),
+			"success":  true,
+		})
+	}
+}
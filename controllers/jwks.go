@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"net/http"
+	"udo-golang/helpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func JWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, helpers.PublicJWKS())
+	}
+}
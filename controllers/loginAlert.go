@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginReportTTL is how long a "this wasn't me" link stays valid.
+const LoginReportTTL = 7 * 24 * time.Hour
+
+// loginReportURL is the page the "this wasn't me" link points at.
+// LOGIN_REPORT_URL lets a frontend handle the link; otherwise it points
+// straight at this API.
+func loginReportURL(token string) string {
+	base := os.Getenv("LOGIN_REPORT_URL")
+	if base == "" {
+		base = strings.TrimRight(os.Getenv("APP_URL"), "/") + "/auth/login-report"
+	}
+	return base + "?token=" + url.QueryEscape(token)
+}
+
+// recordLogin stores the sign-in behind session and, when it comes from an
+// IP and user agent the user has not signed in from before, mails them about
+// it. It runs in the background so a slow mailer never delays sign-in.
+func recordLogin(c *gin.Context, user *models.User, session string) {
+	sessionID, err := primitive.ObjectIDFromHex(session)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	event := models.LoginEvent{
+		ID:         primitive.NewObjectID(),
+		UserID:     user.ID,
+		SessionID:  sessionID,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		DeviceName: helpers.DeviceName(c.Request.UserAgent()),
+		CreatedAt:  now,
+	}
+
+	go func() {
+		hasHistory, knownDevice, err := queries.GetLoginHistory(user.ID, event.IP, event.UserAgent)
+		if err != nil {
+			log.Printf("Failed to check login history: %v", err)
+		}
+
+		// The very first sign-in is expected, so only later ones alert.
+		var token string
+		if err == nil && hasHistory && !knownDevice {
+			token = helpers.NewTokenID()
+			expiresAt := now.Add(LoginReportTTL)
+			event.NewDevice = true
+			event.ReportTokenHash = hashNonce(token)
+			event.ReportExpiresAt = &expiresAt
+		}
+
+		if err := queries.CreateLoginEvent(&event); err != nil {
+			log.Printf("Failed to record login: %v", err)
+			return
+		}
+
+		if token == "" {
+			return
+		}
+
+		err = mailer.SendTemplate(user.Email, mailer.TemplateNewDevice, gin.H{
+			"name":   user.FirstName,
+			"device": event.DeviceName,
+			"ip":     event.IP,
+			"time":   now.UTC().Format("2 January 2006 at 15:04 UTC"),
+			"link":   loginReportURL(token),
+		})
+		if err != nil {
+			log.Printf("Failed to send new device email: %v", err)
+		}
+	}()
+}
+
+// ShowLoginReport handles opening the "this wasn't me" link. It only
+// describes the sign-in; mail scanners and link previews fetch links too, so
+// nothing happens until the user confirms with ReportLogin.
+func ShowLoginReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "The link is invalid or has expired",
+				"success": false,
+			})
+			return
+		}
+
+		event, err := queries.GetLoginReport(hashNonce(token))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "The link is invalid or has expired",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Confirm that you do not recognise this sign-in to sign the device out",
+			"data": gin.H{
+				"device":    event.DeviceName,
+				"ip":        event.IP,
+				"createdAt": event.CreatedAt,
+			},
+			"success": true,
+		})
+	}
+}
+
+// ReportLogin confirms a "this wasn't me" report: it signs the reported
+// session out and mails the user a code to reset their password.
+func ReportLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token string `json:"token" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		event, err := queries.ConsumeLoginReport(hashNonce(input.Token))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "The link is invalid or has expired",
+				"success": false,
+			})
+			return
+		}
+
+		log.Printf("Sign-in reported as unrecognised for user %s (session %s)", event.UserID.Hex(), event.SessionID.Hex())
+
+		if err := queries.RevokeSession(event.UserID, event.SessionID.Hex()); err != nil {
+			log.Printf("Failed to revoke reported session: %v", err)
+		}
+
+		user, err := queries.GetUserByID(event.UserID.Hex())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		code, err := issueOtp(user, models.OtpPurposeReset)
+		if err == nil {
+			err = sendOtpEmail(user, mailer.TemplateReset, code)
+		}
+		if err != nil {
+			log.Printf("Failed to start password reset: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "The device was signed out, but we could not send a password reset code. Please request one",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "The device was signed out. We sent you a code to reset your password",
+			"success": true,
+		})
+	}
+}
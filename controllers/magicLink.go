@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const magicLinkCookie = "magic_link_nonce"
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// magicLinkURL is the page the emailed link points at. MAGIC_LINK_URL lets a
+// frontend handle the link; otherwise it points straight at this API.
+func magicLinkURL(token string) string {
+	base := os.Getenv("MAGIC_LINK_URL")
+	if base == "" {
+		base = strings.TrimRight(os.Getenv("APP_URL"), "/") + "/auth/magic-link/verify"
+	}
+	return base + "?token=" + url.QueryEscape(token)
+}
+
+func SendMagicLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" binding:"required,email"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		// The response is the same whether or not the account exists, so
+		// this endpoint cannot be used to discover registered emails.
+		response := gin.H{
+			"status":  http.StatusOK,
+			"message": "If an account exists for this email, a sign-in link has been sent to it",
+			"success": true,
+		}
+
+		email := strings.ToLower(input.Email)
+
+		foundUser, err := queries.GetUserByEmail(email)
+		if err != nil {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		token, claims, err := helpers.GenerateMagicLinkToken(foundUser.ID.Hex(), foundUser.TokenVersion)
+		if err != nil {
+			log.Printf("Magic link token generation error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to send sign-in link",
+				"success": false,
+			})
+			return
+		}
+
+		nonce := helpers.NewTokenID()
+		link := models.MagicLink{
+			ID:        primitive.NewObjectID(),
+			TokenID:   claims.Id,
+			UserID:    foundUser.ID,
+			NonceHash: hashNonce(nonce),
+			ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+			CreatedAt: time.Now(),
+		}
+
+		if err := queries.CreateMagicLink(&link); err != nil {
+			log.Printf("Failed to store magic link: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to send sign-in link",
+				"success": false,
+			})
+			return
+		}
+
+		err = mailer.SendTemplate(foundUser.Email, mailer.TemplateMagicLink, gin.H{
+			"name":      foundUser.FirstName,
+			"link":      magicLinkURL(token),
+			"expiresIn": int(helpers.MagicLinkTTL.Minutes()),
+		})
+		if err != nil {
+			log.Printf("Failed to send magic link email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to send sign-in link",
+				"success": false,
+			})
+			return
+		}
+
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(magicLinkCookie, nonce, int(helpers.MagicLinkTTL.Seconds()), "/auth/magic-link", "", mailer.IsProduction(), true)
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func VerifyMagicLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, msg := helpers.ValidateMagicLinkToken(c.Query("token"))
+		if msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": msg,
+				"success": false,
+			})
+			return
+		}
+
+		link, err := queries.GetMagicLink(claims.Id)
+		if err != nil || link.UsedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "The sign-in link is invalid or has already been used",
+				"success": false,
+			})
+			return
+		}
+
+		// The nonce is checked before the link is consumed, so opening the
+		// link in another browser does not burn it.
+		nonce, err := c.Cookie(magicLinkCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(hashNonce(nonce)), []byte(link.NonceHash)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Open the sign-in link in the browser where you requested it",
+				"success": false,
+			})
+			return
+		}
+
+		consumed, err := queries.ConsumeMagicLink(claims.Id)
+		if err != nil || !consumed {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "The sign-in link is invalid or has already been used",
+				"success": false,
+			})
+			return
+		}
+
+		c.SetCookie(magicLinkCookie, "", -1, "/auth/magic-link", "", mailer.IsProduction(), true)
+
+		foundUser, err := queries.GetUserByID(claims.ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		// Following the link proves control of the mailbox, which is all
+		// account verification asks for.
+		if !foundUser.IsVerified {
+			updateData := bson.M{"isVerified": true}
+			if err := queries.UpdateUser(foundUser.ID.Hex(), updateData); err != nil {
+				log.Printf("Failed to verify account: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  http.StatusInternalServerError,
+					"message": "Failed to complete account verification",
+					"success": false,
+				})
+				return
+			}
+			foundUser.IsVerified = true
+			sendWelcomeEmail(*foundUser)
+		}
+
+		if requireMfa(c, foundUser) {
+			return
+		}
+
+		completeLogin(c, foundUser)
+	}
+}
@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func mfaIssuer() string {
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "udo-golang"
+}
+
+// requireMfa answers with an MFA challenge instead of tokens when the user has
+// two-factor authentication enabled. It reports whether it wrote a response.
+func requireMfa(c *gin.Context, foundUser *models.User) bool {
+	if !foundUser.MfaEnabled {
+		return false
+	}
+
+	mfaToken, err := helpers.GenerateMfaToken(foundUser.ID.Hex(), foundUser.TokenVersion)
+	if err != nil {
+		log.Printf("MFA token generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Failed to generate authentication tokens",
+			"success": false,
+		})
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"message": "Two-factor authentication required",
+		"data": gin.H{
+			"mfaRequired": true,
+			"mfaToken":    mfaToken,
+		},
+		"success": true,
+	})
+	return true
+}
+
+func EnrollMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		foundUser, err := queries.GetUserByID(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		if foundUser.MfaEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Two-factor authentication is already enabled",
+				"success": false,
+			})
+			return
+		}
+
+		secret, err := helpers.GenerateTotpSecret()
+		if err != nil {
+			log.Printf("Error generating TOTP secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start two-factor enrollment",
+				"success": false,
+			})
+			return
+		}
+
+		// The secret stays pending until the user proves their app can
+		// generate codes for it.
+		if err := queries.UpdateUser(foundUser.ID.Hex(), bson.M{"mfaPendingSecret": secret}); err != nil {
+			log.Printf("Failed to store pending TOTP secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start two-factor enrollment",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Scan the QR code with your authenticator app, then confirm with a code",
+			"data": gin.H{
+				"secret":     secret,
+				"otpauthUri": helpers.TotpURI(mfaIssuer(), foundUser.Email, secret),
+			},
+			"success": true,
+		})
+	}
+}
+
+func ConfirmMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		foundUser, err := queries.GetUserByID(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		if foundUser.MfaEnabled || foundUser.MfaPendingSecret == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "No two-factor enrollment in progress",
+				"success": false,
+			})
+			return
+		}
+
+		step, ok := helpers.ValidateTotp(*foundUser.MfaPendingSecret, input.Code, 0)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid authentication code",
+				"success": false,
+			})
+			return
+		}
+
+		backupCodes, backupHashes, err := helpers.GenerateBackupCodes()
+		if err != nil {
+			log.Printf("Error generating backup codes: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to enable two-factor authentication",
+				"success": false,
+			})
+			return
+		}
+
+		update := bson.M{
+			"mfaEnabled":       true,
+			"mfaSecret":        *foundUser.MfaPendingSecret,
+			"mfaPendingSecret": nil,
+			"mfaLastUsedStep":  step,
+			"mfaBackupCodes":   backupHashes,
+		}
+
+		if err := queries.UpdateUser(foundUser.ID.Hex(), update); err != nil {
+			log.Printf("Failed to enable MFA: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to enable two-factor authentication",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Two-factor authentication enabled. Store these backup codes somewhere safe, they will not be shown again",
+			"data": gin.H{
+				"backupCodes": backupCodes,
+			},
+			"success": true,
+		})
+	}
+}
+
+func LoginMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			MfaToken   string `json:"mfaToken" binding:"required"`
+			Code       string `json:"code"`
+			BackupCode string `json:"backupCode"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		if input.Code == "" && input.BackupCode == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "An authentication code or backup code is required",
+				"success": false,
+			})
+			return
+		}
+
+		claims, msg := helpers.ValidateMfaToken(input.MfaToken)
+		if msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": msg,
+				"success": false,
+			})
+			return
+		}
+
+		foundUser, err := queries.GetUserByID(claims.ID)
+		if err != nil || !foundUser.MfaEnabled || foundUser.MfaSecret == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "The MFA token is invalid",
+				"success": false,
+			})
+			return
+		}
+
+		if !attemptAllowed(c, foundUser) {
+			return
+		}
+
+		verified := false
+		if input.Code != "" {
+			if step, ok := helpers.ValidateTotp(*foundUser.MfaSecret, input.Code, foundUser.MfaLastUsedStep); ok {
+				verified, err = queries.RecordTotpStep(foundUser.ID.Hex(), step)
+			}
+		} else {
+			verified, err = queries.ConsumeBackupCode(foundUser.ID.Hex(), helpers.HashBackupCode(input.BackupCode))
+		}
+		if err != nil {
+			log.Printf("MFA verification error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to verify authentication code",
+				"success": false,
+			})
+			return
+		}
+
+		if !verified {
+			recordFailedAttempt(c, foundUser)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Invalid authentication code",
+				"success": false,
+			})
+			return
+		}
+
+		completeLogin(c, foundUser)
+	}
+}
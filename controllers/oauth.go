@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
+	"udo-golang/models"
+	"udo-golang/oauth"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+)
+
+func oauthCookiePath(provider string) string {
+	return "/auth/" + provider
+}
+
+// setOAuthStateCookie binds the sign-in attempt to this browser. Providers
+// that post the callback cross-site need SameSite=None, which in turn
+// requires a secure cookie.
+func setOAuthStateCookie(c *gin.Context, provider *oauth.Provider, value string, maxAge int) {
+	secure := mailer.IsProduction()
+	if provider.FormPost {
+		c.SetSameSite(http.SameSiteNoneMode)
+		secure = true
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie(oauthStateCookie, value, maxAge, oauthCookiePath(provider.Name), "", secure, true)
+}
+
+// beginOAuth records a new sign-in attempt with provider, binds it to the
+// browser and returns the provider's authorization URL. linkUserID is set
+// when the attempt links the provider to a signed-in user. On failure it
+// writes the response and returns false.
+func beginOAuth(c *gin.Context, provider *oauth.Provider, linkUserID *primitive.ObjectID) (string, bool) {
+	now := time.Now()
+	state := &models.OAuthState{
+		ID:           primitive.NewObjectID(),
+		State:        helpers.NewTokenID(),
+		Provider:     provider.Name,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        helpers.NewTokenID(),
+		LinkUserID:   linkUserID,
+		ExpiresAt:    now.Add(oauthStateTTL),
+		CreatedAt:    now,
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state.State, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("OAuth start error (%s): %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  http.StatusBadGateway,
+			"message": "Sign-in provider is unavailable",
+			"success": false,
+		})
+		return "", false
+	}
+
+	if err := queries.CreateOAuthState(state); err != nil {
+		log.Printf("Failed to store OAuth state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Failed to start sign-in",
+			"success": false,
+		})
+		return "", false
+	}
+
+	setOAuthStateCookie(c, provider, state.State, int(oauthStateTTL.Seconds()))
+	return authURL, true
+}
+
+func OAuthStart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := oauth.Get(c.Param("provider"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Unknown sign-in provider",
+				"success": false,
+			})
+			return
+		}
+
+		if authURL, ok := beginOAuth(c, provider, nil); ok {
+			c.Redirect(http.StatusFound, authURL)
+		}
+	}
+}
+
+// OAuthCallback handles the provider's redirect back, either as a GET with
+// query parameters or, for form_post providers, as a POST.
+func OAuthCallback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := oauth.Get(c.Param("provider"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Unknown sign-in provider",
+				"success": false,
+			})
+			return
+		}
+
+		if err := c.Request.ParseForm(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+		form := c.Request.Form
+
+		cookie, _ := c.Cookie(oauthStateCookie)
+		setOAuthStateCookie(c, provider, "", -1)
+
+		if form.Get("error") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Sign-in was cancelled or denied",
+				"success": false,
+			})
+			return
+		}
+
+		stateValue := form.Get("state")
+		if stateValue == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(stateValue)) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Sign-in must be completed in the browser that started it",
+				"success": false,
+			})
+			return
+		}
+
+		state, err := queries.ConsumeOAuthState(stateValue, provider.Name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "The sign-in attempt has expired, please try again",
+				"success": false,
+			})
+			return
+		}
+
+		profile, err := provider.Exchange(c.Request.Context(), form.Get("code"), state.CodeVerifier, state.Nonce, form)
+		if err != nil {
+			log.Printf("OAuth callback error (%s): %v", provider.Name, err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Sign-in with the provider failed",
+				"success": false,
+			})
+			return
+		}
+
+		if state.LinkUserID != nil {
+			linkProfile(c, *state.LinkUserID, profile)
+			return
+		}
+
+		signInWithProfile(c, profile)
+	}
+}
+
+// signInWithProfile signs in the account an external provider vouched for.
+// A linked identity decides the account; otherwise a verified email adopts an
+// existing verified account or a new one is created, and the identity is
+// linked.
+func signInWithProfile(c *gin.Context, profile *oauth.Profile) {
+	if profile.Subject == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "The provider did not identify the account",
+			"success": false,
+		})
+		return
+	}
+
+	if identity, err := queries.GetIdentity(profile.Provider, profile.Subject); err == nil {
+		foundUser, err := queries.GetUserByID(identity.UserID.Hex())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+		if requireMfa(c, foundUser) {
+			return
+		}
+		completeLogin(c, foundUser)
+		return
+	}
+
+	// Matching on an address the provider has not verified would let anyone
+	// who registers it there take over the local account.
+	if profile.Email == "" || !profile.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "The provider did not return a verified email address",
+			"success": false,
+		})
+		return
+	}
+
+	// Accounts are stored under lowercase emails, as signup and magic link
+	// sign-in already do.
+	profile.Email = strings.ToLower(profile.Email)
+
+	foundUser, err := queries.GetUserByEmail(profile.Email)
+	if err == nil {
+		// Whoever registered an unverified account never proved they own the
+		// address, and may still hold its password. Adopting it would hand
+		// them the provider user's sign-in, so it has to be verified first.
+		if !foundUser.IsVerified {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  http.StatusConflict,
+				"message": "An unverified account already uses this email; verify it before signing in with " + profile.Provider,
+				"success": false,
+			})
+			return
+		}
+
+		identities, err := queries.GetIdentitiesByUser(foundUser.ID)
+		if err != nil {
+			log.Printf("Failed to fetch identities: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to sign in",
+				"success": false,
+			})
+			return
+		}
+
+		// The account already trusts a different account at this provider,
+		// so the address has most likely been reassigned there.
+		for _, identity := range identities {
+			if identity.Provider == profile.Provider {
+				c.JSON(http.StatusConflict, gin.H{
+					"status":  http.StatusConflict,
+					"message": "This email belongs to an account linked to a different " + profile.Provider + " account",
+					"success": false,
+				})
+				return
+			}
+		}
+
+		if err := createIdentity(foundUser.ID, profile); err != nil {
+			log.Printf("Failed to link identity: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to sign in",
+				"success": false,
+			})
+			return
+		}
+
+		if requireMfa(c, foundUser) {
+			return
+		}
+		completeLogin(c, foundUser)
+		return
+	}
+
+	newUser := models.User{
+		ID:         primitive.NewObjectID(),
+		FirstName:  profile.FirstName,
+		LastName:   profile.LastName,
+		Email:      profile.Email,
+		IsVerified: true,
+		CreatedAt:  time.Now(),
+	}
+
+	if _, err := queries.CreateNewUser(&newUser); err != nil {
+		log.Printf("Error inserting user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Failed to create user",
+			"success": false,
+		})
+		return
+	}
+
+	if err := createIdentity(newUser.ID, profile); err != nil {
+		log.Printf("Failed to link identity: %v", err)
+	}
+
+	sendWelcomeEmail(newUser)
+	completeLogin(c, &newUser)
+}
+
+func createIdentity(userID primitive.ObjectID, profile *oauth.Profile) error {
+	return queries.CreateIdentity(&models.Identity{
+		ID:       primitive.NewObjectID(),
+		UserID:   userID,
+		Provider: profile.Provider,
+		Subject:  profile.Subject,
+		Email:    profile.Email,
+		LinkedAt: time.Now(),
+	})
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// otpTemplates maps each OTP purpose mailed through SendOtp to its template.
+var otpTemplates = map[string]string{
+	models.OtpPurposeVerify: mailer.TemplateVerification,
+	models.OtpPurposeReset:  mailer.TemplateReset,
+}
+
+// issueOtp generates a code for user and purpose, replacing any live one, and
+// returns it so the caller can mail it. Only its hash is stored.
+func issueOtp(user *models.User, purpose string) (string, error) {
+	return issueOtpTo(user, purpose, "")
+}
+
+// issueOtpTo issues a code that only confirms target, the address it is
+// mailed to.
+func issueOtpTo(user *models.User, purpose string, target string) (string, error) {
+	code, err := helpers.GenerateOtp()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = queries.SaveOtp(&models.Otp{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		CodeHash:  helpers.HashOtp(user.ID.Hex(), purpose, code),
+		Target:    target,
+		ExpiresAt: now.Add(helpers.OtpTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// verifyOtp checks code against the user's live OTP for purpose and consumes
+// it on success. On failure it writes the response and returns false.
+func verifyOtp(c *gin.Context, user *models.User, purpose string, code string) bool {
+	return verifyOtpFor(c, user, purpose, code, "")
+}
+
+// verifyOtpFor is verifyOtp for a code issued by issueOtpTo, which must have
+// been mailed to target.
+func verifyOtpFor(c *gin.Context, user *models.User, purpose string, code string, target string) bool {
+	fail := func(status int, message string) bool {
+		c.JSON(status, gin.H{
+			"status":  status,
+			"message": message,
+			"success": false,
+		})
+		return false
+	}
+
+	otp, err := queries.AttemptOtp(user.ID, purpose)
+	if errors.Is(err, queries.ErrOtpNotFound) {
+		recordFailedAttempt(c, user)
+		return fail(http.StatusBadRequest, "Invalid OTP")
+	}
+	if err != nil {
+		log.Printf("OTP verification error: %v", err)
+		return fail(http.StatusInternalServerError, "Failed to verify OTP")
+	}
+
+	if time.Now().After(otp.ExpiresAt) {
+		return fail(http.StatusBadRequest, "OTP has expired")
+	}
+
+	if otp.Attempts >= helpers.OtpMaxAttempts {
+		return fail(http.StatusBadRequest, "Too many incorrect attempts, please request a new OTP")
+	}
+
+	if otp.Target != target || !helpers.OtpMatches(otp.CodeHash, user.ID.Hex(), purpose, code) {
+		recordFailedAttempt(c, user)
+		return fail(http.StatusBadRequest, "Invalid OTP")
+	}
+
+	consumed, err := queries.ConsumeOtp(otp.ID)
+	if err != nil {
+		log.Printf("OTP consume error: %v", err)
+		return fail(http.StatusInternalServerError, "Failed to verify OTP")
+	}
+	if !consumed {
+		// A concurrent request used the same code first.
+		return fail(http.StatusBadRequest, "Invalid OTP")
+	}
+
+	return true
+}
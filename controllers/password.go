@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkPasswordPolicy validates a new password against the configured
+// policy. personal is the user's name and email, which the password may not
+// contain. On failure it responds with every reason, keyed by field, and
+// returns false.
+func checkPasswordPolicy(c *gin.Context, field string, password string, personal ...string) bool {
+	violations := helpers.GetPasswordPolicy().CheckPassword(field, password, personal...)
+	if len(violations) == 0 {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status":  http.StatusBadRequest,
+		"message": "Password does not meet the requirements",
+		"errors":  violations,
+		"success": false,
+	})
+	return false
+}
+
+// rehashPassword upgrades the user's stored hash to the current scheme and
+// parameters after they proved the password, without delaying the response.
+func rehashPassword(user *models.User, password string) {
+	if !helpers.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	go func() {
+		hashedPassword, err := helpers.HashPassword(password)
+		if err != nil {
+			log.Printf("Failed to rehash password: %v", err)
+			return
+		}
+		if err := queries.RehashPassword(user.ID.Hex(), user.Password, hashedPassword); err != nil {
+			log.Printf("Failed to store rehashed password: %v", err)
+		}
+	}()
+}
+
+// checkPasswordHistory rejects a new password that matches the user's
+// current one or any remembered previous one. On failure it writes the
+// response and returns false.
+func checkPasswordHistory(c *gin.Context, field string, user *models.User, password string) bool {
+	// Only the newest HistorySize hashes count, so lowering the setting,
+	// even to 0, takes effect before the stored history is next trimmed.
+	history := user.PasswordHistory
+	if size := helpers.GetPasswordPolicy().HistorySize; len(history) > size {
+		history = history[len(history)-size:]
+	}
+
+	hashes := append([]string{user.Password}, history...)
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		if reused, _ := helpers.VerifyPassword(password, hash); reused {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Password does not meet the requirements",
+				"errors": []helpers.PasswordViolation{{
+					Field:   field,
+					Code:    "reused",
+					Message: "You have used this password recently, please choose a different one",
+				}},
+				"success": false,
+			})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validScopes checks requested scopes against the known ones and returns them
+// sorted and de-duplicated.
+func validScopes(c *gin.Context, scopes []string) ([]string, bool) {
+	for _, scope := range scopes {
+		if !slices.Contains(helpers.KnownScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unknown scope: " + scope,
+				"success": false,
+			})
+			return nil, false
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(scopes))), true
+}
+
+func CreateServiceAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Name   string   `json:"name" binding:"required"`
+			Scopes []string `json:"scopes" binding:"required,min=1"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request payload",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		scopes, ok := validScopes(c, input.Scopes)
+		if !ok {
+			return
+		}
+
+		createdBy, err := primitive.ObjectIDFromHex(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		clientID, err := helpers.GenerateClientID()
+		if err != nil {
+			log.Printf("Client ID generation error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to create service account",
+				"success": false,
+			})
+			return
+		}
+
+		secret, hash, err := helpers.GenerateClientSecret()
+		if err != nil {
+			log.Printf("Client secret generation error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to create service account",
+				"success": false,
+			})
+			return
+		}
+
+		now := time.Now()
+		account := models.ServiceAccount{
+			ID:         primitive.NewObjectID(),
+			Name:       input.Name,
+			ClientID:   clientID,
+			SecretHash: hash,
+			Scopes:     scopes,
+			CreatedBy:  createdBy,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+
+		if err := queries.CreateServiceAccount(&account); err != nil {
+			log.Printf("Failed to store service account: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to create service account",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "Service account created. Copy the client secret now, it will not be shown again",
+			"data": gin.H{
+				"serviceAccount": account,
+				"clientSecret":   secret,
+			},
+			"success": true,
+		})
+	}
+}
+
+func GetServiceAccounts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accounts, err := queries.GetServiceAccounts()
+		if err != nil {
+			log.Printf("Failed to fetch service accounts: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to fetch service accounts",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Service accounts fetched successfully",
+			"data":    accounts,
+			"success": true,
+		})
+	}
+}
+
+func RotateServiceAccountSecret() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret, hash, err := helpers.GenerateClientSecret()
+		if err != nil {
+			log.Printf("Client secret generation error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to rotate the client secret",
+				"success": false,
+			})
+			return
+		}
+
+		if err := queries.RotateServiceAccountSecret(c.Param("id"), hash); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to rotate the secret of this service account",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Client secret rotated. Copy it now, it will not be shown again",
+			"data":    gin.H{"clientSecret": secret},
+			"success": true,
+		})
+	}
+}
+
+func DeleteServiceAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := queries.DeleteServiceAccount(c.Param("id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to delete this service account",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Service account deleted successfully",
+			"success": true,
+		})
+	}
+}
+
+// tokenError writes an OAuth2 error response (RFC 6749 section 5.2).
+func tokenError(c *gin.Context, status int, code string, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// ServiceToken is the OAuth2 token endpoint for service accounts. It only
+// supports the client_credentials grant and, unlike the rest of the API,
+// speaks the RFC 6749 wire format so standard OAuth2 clients can use it.
+func ServiceToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.PostForm("grant_type") != "client_credentials" {
+			tokenError(c, http.StatusBadRequest, "unsupported_grant_type", "Only the client_credentials grant is supported")
+			return
+		}
+
+		clientID, secret, basic := c.Request.BasicAuth()
+		if basic {
+			// Basic credentials are form-encoded before being joined.
+			var idErr, secretErr error
+			clientID, idErr = url.QueryUnescape(clientID)
+			secret, secretErr = url.QueryUnescape(secret)
+			if idErr != nil || secretErr != nil {
+				tokenError(c, http.StatusBadRequest, "invalid_request", "Malformed client credentials")
+				return
+			}
+		} else {
+			clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+		}
+
+		if clientID == "" || secret == "" {
+			tokenError(c, http.StatusBadRequest, "invalid_request", "Client credentials are required")
+			return
+		}
+
+		account, ok := helpers.AuthenticateClient(clientID, secret)
+		if !ok {
+			if basic {
+				c.Header("WWW-Authenticate", `Basic realm="token"`)
+			}
+			tokenError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+			return
+		}
+
+		// With no scope parameter the token gets every scope of the account.
+		scopes := account.Scopes
+		if requested := strings.Fields(c.PostForm("scope")); len(requested) > 0 {
+			for _, scope := range requested {
+				if !slices.Contains(account.Scopes, scope) {
+					tokenError(c, http.StatusBadRequest, "invalid_scope", "The client may not request the "+scope+" scope")
+					return
+				}
+			}
+			scopes = slices.Compact(slices.Sorted(slices.Values(requested)))
+		}
+
+		token, _, err := helpers.GenerateServiceToken(account, scopes)
+		if err != nil {
+			log.Printf("Failed to sign service token: %v", err)
+			tokenError(c, http.StatusInternalServerError, "server_error", "Failed to issue a token")
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int(helpers.ServiceTokenTTL.Seconds()),
+			"scope":        strings.Join(scopes, " "),
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"udo-golang/helpers"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// listSessions responds with the active sessions of userID, flagging the one
+// the request was made from.
+func listSessions(c *gin.Context, userID string, current string) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "User account does not exist",
+			"success": false,
+		})
+		return
+	}
+
+	sessions, err := queries.GetActiveSessionsByUser(objID)
+	if err != nil {
+		log.Printf("Failed to fetch sessions: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "Unable to fetch sessions",
+			"success": false,
+		})
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == current
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"message": "Sessions fetched successfully",
+		"data":    sessions,
+		"success": true,
+	})
+}
+
+func revokeSession(c *gin.Context, userID string, sessionID string) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "User account does not exist",
+			"success": false,
+		})
+		return
+	}
+
+	if err := queries.RevokeSession(objID, sessionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "Unable to revoke this session",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"message": "Session revoked successfully",
+		"success": true,
+	})
+}
+
+func GetSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*helpers.SignedDetails)
+		listSessions(c, claims.ID, claims.Session)
+	}
+}
+
+func RevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revokeSession(c, c.GetString("id"), c.Param("id"))
+	}
+}
+
+func GetUserSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listSessions(c, c.Param("id"), "")
+	}
+}
+
+func RevokeUserSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revokeSession(c, c.Param("id"), c.Param("sessionId"))
+	}
+}
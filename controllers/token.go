@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// issueTokens signs a new access/refresh pair for user and records the refresh
+// token so it can be rotated later. An empty family starts a new session for
+// the device making the request; otherwise that session is extended.
+func issueTokens(c *gin.Context, user *models.User, family string) (*helpers.TokenPair, error) {
+	now := time.Now()
+
+	if family == "" {
+		session := models.Session{
+			ID:         primitive.NewObjectID(),
+			UserID:     user.ID,
+			DeviceName: helpers.DeviceName(c.Request.UserAgent()),
+			UserAgent:  c.Request.UserAgent(),
+			IP:         c.ClientIP(),
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(helpers.RefreshTokenTTL),
+			CreatedAt:  now,
+		}
+		if err := queries.CreateSession(&session); err != nil {
+			return nil, err
+		}
+		family = session.ID.Hex()
+	} else if err := queries.ExtendSession(family, c.ClientIP(), now.Add(helpers.RefreshTokenTTL)); err != nil {
+		log.Printf("Failed to extend session: %v", err)
+	}
+
+	pair, err := helpers.GenerateAllTokens(helpers.SignedDetails{
+		Email:   user.Email,
+		ID:      user.ID.Hex(),
+		IsAdmin: user.IsAdmin,
+		Version: user.TokenVersion,
+	}, family)
+	if err != nil {
+		return nil, err
+	}
+
+	err = queries.CreateRefreshToken(&models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		TokenID:   pair.RefreshClaims.Id,
+		Family:    pair.RefreshClaims.Family,
+		UserID:    user.ID,
+		ExpiresAt: time.Unix(pair.RefreshClaims.ExpiresAt, 0),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// completeLogin finishes a successful sign-in once every required factor has
+// been checked: it issues tokens, records the login, alerting the user to new
+// devices, and writes the response.
+func completeLogin(c *gin.Context, foundUser *models.User) {
+	tokens, err := issueTokens(c, foundUser, "")
+	if err != nil {
+		log.Printf("Token generation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Failed to generate authentication tokens",
+			"success": false,
+		})
+		return
+	}
+
+	now := time.Now()
+	update := lockoutReset()
+	update["lastLogin"] = &now
+	if err := queries.UpdateUser(foundUser.ID.Hex(), update); err != nil {
+		log.Printf("Failed to update last login: %v", err)
+	}
+
+	recordLogin(c, foundUser, tokens.RefreshClaims.Family)
+
+	// Signing in during the grace period keeps the account.
+	deletionCancelled := false
+	if foundUser.DeletionScheduledAt != nil {
+		if err := queries.CancelAccountDeletion(foundUser.ID.Hex()); err != nil {
+			log.Printf("Failed to cancel account deletion: %v", err)
+		} else {
+			deletionCancelled = true
+		}
+	}
+
+	response := gin.H{
+		"id":           foundUser.ID,
+		"firstName":    foundUser.FirstName,
+		"lastName":     foundUser.LastName,
+		"email":        foundUser.Email,
+		"isAdmin":      foundUser.IsAdmin,
+		"isVerified":   foundUser.IsVerified,
+		"lastLogin":    now,
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+	}
+	if deletionCancelled {
+		response["deletionCancelled"] = true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"message": "Login successful",
+		"data":    response,
+		"success": true,
+	})
+}
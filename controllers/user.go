@@ -210,3 +210,26 @@ func UpdateUser() gin.HandlerFunc {
 		})
 	}
 }
+
+func UnlockUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		err := queries.UpdateUser(id, lockoutReset())
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"success": false,
+				"message": "Unable to unlock this User",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"success": true,
+			"message": "User Unlocked Successfully",
+		})
+	}
+}
@@ -0,0 +1,442 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+// passkeyStore is the storage behind the passkey ceremonies. Tests swap it
+// for an in-memory one to run the ceremonies against a software authenticator.
+type passkeyStore interface {
+	GetUser(userID string) (*models.User, error)
+	GetCredentials(userID string) ([]models.WebauthnCredential, error)
+	GetCredential(credentialID []byte) (*models.WebauthnCredential, error)
+	CreateCredential(credential *models.WebauthnCredential) error
+	UpdateCredentialUsage(credential *models.WebauthnCredential) error
+	CreateSession(session *models.WebauthnSession) error
+	ConsumeSession(sessionID string, ceremony string) (*models.WebauthnSession, error)
+}
+
+type mongoPasskeyStore struct{}
+
+func (mongoPasskeyStore) GetUser(userID string) (*models.User, error) {
+	return queries.GetUserByID(userID)
+}
+
+func (mongoPasskeyStore) GetCredentials(userID string) ([]models.WebauthnCredential, error) {
+	return queries.GetWebauthnCredentialsByUser(userID)
+}
+
+func (mongoPasskeyStore) GetCredential(credentialID []byte) (*models.WebauthnCredential, error) {
+	return queries.GetWebauthnCredentialByCredentialID(credentialID)
+}
+
+func (mongoPasskeyStore) CreateCredential(credential *models.WebauthnCredential) error {
+	return queries.CreateWebauthnCredential(credential)
+}
+
+func (mongoPasskeyStore) UpdateCredentialUsage(credential *models.WebauthnCredential) error {
+	return queries.UpdateWebauthnCredentialUsage(credential)
+}
+
+func (mongoPasskeyStore) CreateSession(session *models.WebauthnSession) error {
+	return queries.CreateWebauthnSession(session)
+}
+
+func (mongoPasskeyStore) ConsumeSession(sessionID string, ceremony string) (*models.WebauthnSession, error) {
+	return queries.ConsumeWebauthnSession(sessionID, ceremony)
+}
+
+var (
+	passkeys passkeyStore = mongoPasskeyStore{}
+
+	// completePasskeyLogin finishes a successful passkey login.
+	completePasskeyLogin = completeLogin
+)
+
+// webauthnUser adapts models.User to the webauthn.User interface. The user
+// handle is the raw ObjectID, which carries no personal data.
+type webauthnUser struct {
+	user        *models.User
+	credentials []models.WebauthnCredential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.FirstName + " " + u.user.LastName
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		credentials = append(credentials, c.Credential)
+	}
+	return credentials
+}
+
+func loadWebauthnUser(userID string) (*webauthnUser, error) {
+	foundUser, err := passkeys.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := passkeys.GetCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webauthnUser{user: foundUser, credentials: credentials}, nil
+}
+
+func webauthnUnavailable(c *gin.Context, err error) {
+	log.Printf("WebAuthn is not configured: %v", err)
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"status":  http.StatusServiceUnavailable,
+		"message": "Passkeys are not available",
+		"success": false,
+	})
+}
+
+func BeginPasskeyRegistration() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wa, err := helpers.WebAuthn()
+		if err != nil {
+			webauthnUnavailable(c, err)
+			return
+		}
+
+		waUser, err := loadWebauthnUser(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		creation, sessionData, err := wa.BeginRegistration(
+			waUser,
+			webauthn.WithExclusions(webauthn.Credentials(waUser.WebAuthnCredentials()).CredentialDescriptors()),
+			webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		)
+		if err != nil {
+			log.Printf("Failed to begin passkey registration: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start passkey registration",
+				"success": false,
+			})
+			return
+		}
+
+		session := models.WebauthnSession{
+			ID:        primitive.NewObjectID(),
+			SessionID: helpers.NewTokenID(),
+			Ceremony:  ceremonyRegistration,
+			UserID:    &waUser.user.ID,
+			Data:      *sessionData,
+			ExpiresAt: time.Now().Add(helpers.WebauthnSessionTTL),
+		}
+
+		if err := passkeys.CreateSession(&session); err != nil {
+			log.Printf("Failed to store passkey session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start passkey registration",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Passkey registration started",
+			"data": gin.H{
+				"sessionId": session.SessionID,
+				"options":   creation,
+			},
+			"success": true,
+		})
+	}
+}
+
+// FinishPasskeyRegistration expects the browser's PublicKeyCredential as the
+// request body and the sessionId from the begin step as a query parameter.
+func FinishPasskeyRegistration() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wa, err := helpers.WebAuthn()
+		if err != nil {
+			webauthnUnavailable(c, err)
+			return
+		}
+
+		session, err := passkeys.ConsumeSession(c.Query("sessionId"), ceremonyRegistration)
+		if err != nil || session.UserID == nil || session.UserID.Hex() != c.GetString("id") {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Passkey registration session is invalid or has expired",
+				"success": false,
+			})
+			return
+		}
+
+		waUser, err := loadWebauthnUser(session.UserID.Hex())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		parsed, err := protocol.ParseCredentialCreationResponseBody(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid passkey registration response",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		credential, err := wa.CreateCredential(waUser, session.Data, parsed)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Passkey registration failed",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		name := c.Query("name")
+		if name == "" {
+			name = "Passkey"
+		}
+
+		stored := models.WebauthnCredential{
+			ID:           primitive.NewObjectID(),
+			UserID:       waUser.user.ID,
+			CredentialID: credential.ID,
+			Name:         name,
+			Credential:   *credential,
+			CreatedAt:    time.Now(),
+		}
+
+		if err := passkeys.CreateCredential(&stored); err != nil {
+			log.Printf("Failed to store passkey: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to save passkey",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "Passkey registered successfully",
+			"data":    stored,
+			"success": true,
+		})
+	}
+}
+
+func BeginPasskeyLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wa, err := helpers.WebAuthn()
+		if err != nil {
+			webauthnUnavailable(c, err)
+			return
+		}
+
+		assertion, sessionData, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			log.Printf("Failed to begin passkey login: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start passkey login",
+				"success": false,
+			})
+			return
+		}
+
+		session := models.WebauthnSession{
+			ID:        primitive.NewObjectID(),
+			SessionID: helpers.NewTokenID(),
+			Ceremony:  ceremonyLogin,
+			Data:      *sessionData,
+			ExpiresAt: time.Now().Add(helpers.WebauthnSessionTTL),
+		}
+
+		if err := passkeys.CreateSession(&session); err != nil {
+			log.Printf("Failed to store passkey session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Failed to start passkey login",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Passkey login started",
+			"data": gin.H{
+				"sessionId": session.SessionID,
+				"options":   assertion,
+			},
+			"success": true,
+		})
+	}
+}
+
+// FinishPasskeyLogin expects the browser's assertion as the request body and
+// the sessionId from the begin step as a query parameter. On success it
+// issues the same token pair as Login.
+func FinishPasskeyLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wa, err := helpers.WebAuthn()
+		if err != nil {
+			webauthnUnavailable(c, err)
+			return
+		}
+
+		session, err := passkeys.ConsumeSession(c.Query("sessionId"), ceremonyLogin)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Passkey login session is invalid or has expired",
+				"success": false,
+			})
+			return
+		}
+
+		parsed, err := protocol.ParseCredentialRequestResponseBody(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid passkey login response",
+				"error":   err.Error(),
+				"success": false,
+			})
+			return
+		}
+
+		var stored *models.WebauthnCredential
+		handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+			credential, err := passkeys.GetCredential(rawID)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(credential.UserID[:], userHandle) {
+				return nil, errors.New("passkey does not belong to this user")
+			}
+			stored = credential
+			return loadWebauthnUser(credential.UserID.Hex())
+		}
+
+		waUser, credential, err := wa.ValidatePasskeyLogin(handler, session.Data, parsed)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Passkey login failed",
+				"success": false,
+			})
+			return
+		}
+
+		if credential.Authenticator.CloneWarning {
+			log.Printf("Passkey %s of user %s reported a sign counter regression", stored.ID.Hex(), stored.UserID.Hex())
+		}
+
+		stored.Credential = *credential
+		if err := passkeys.UpdateCredentialUsage(stored); err != nil {
+			log.Printf("Failed to update passkey usage: %v", err)
+		}
+
+		completePasskeyLogin(c, waUser.(*webauthnUser).user)
+	}
+}
+
+func GetPasskeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credentials, err := queries.GetWebauthnCredentialsByUser(c.GetString("id"))
+		if err != nil {
+			log.Printf("Failed to fetch passkeys: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to fetch passkeys",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Passkeys fetched successfully",
+			"data":    credentials,
+			"success": true,
+		})
+	}
+}
+
+func DeletePasskey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		foundUser, err := queries.GetUserByID(c.GetString("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "User account does not exist",
+				"success": false,
+			})
+			return
+		}
+
+		if !requireOtherLoginMethod(c, foundUser) {
+			return
+		}
+
+		if err := queries.DeleteWebauthnCredential(c.GetString("id"), c.Param("id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to delete this passkey",
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Passkey deleted successfully",
+			"success": true,
+		})
+	}
+}
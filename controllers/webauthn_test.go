@@ -0,0 +1,433 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"udo-golang/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	testRPID   = "example.test"
+	testOrigin = "https://example.test"
+)
+
+// memoryPasskeyStore keeps passkey state in memory for the ceremony tests.
+type memoryPasskeyStore struct {
+	mu          sync.Mutex
+	users       map[string]*models.User
+	credentials []models.WebauthnCredential
+	sessions    map[string]models.WebauthnSession
+}
+
+func newMemoryPasskeyStore(users ...*models.User) *memoryPasskeyStore {
+	store := &memoryPasskeyStore{
+		users:    map[string]*models.User{},
+		sessions: map[string]models.WebauthnSession{},
+	}
+	for _, user := range users {
+		store.users[user.ID.Hex()] = user
+	}
+	return store
+}
+
+func (s *memoryPasskeyStore) GetUser(userID string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[userID]; ok {
+		return user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func (s *memoryPasskeyStore) GetCredentials(userID string) ([]models.WebauthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var credentials []models.WebauthnCredential
+	for _, credential := range s.credentials {
+		if credential.UserID.Hex() == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (s *memoryPasskeyStore) GetCredential(credentialID []byte) (*models.WebauthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, credential := range s.credentials {
+		if bytes.Equal(credential.CredentialID, credentialID) {
+			return &credential, nil
+		}
+	}
+	return nil, errors.New("passkey not found")
+}
+
+func (s *memoryPasskeyStore) CreateCredential(credential *models.WebauthnCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credentials = append(s.credentials, *credential)
+	return nil
+}
+
+func (s *memoryPasskeyStore) UpdateCredentialUsage(credential *models.WebauthnCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.credentials {
+		if s.credentials[i].ID == credential.ID {
+			s.credentials[i] = *credential
+		}
+	}
+	return nil
+}
+
+func (s *memoryPasskeyStore) CreateSession(session *models.WebauthnSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.SessionID] = *session
+	return nil
+}
+
+func (s *memoryPasskeyStore) ConsumeSession(sessionID string, ceremony string) (*models.WebauthnSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok || session.Ceremony != ceremony {
+		return nil, errors.New("passkey session not found")
+	}
+	delete(s.sessions, sessionID)
+	return &session, nil
+}
+
+// softAuthenticator is a software passkey: a P-256 key pair with "none"
+// attestation, producing the responses a browser would send.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+func (a *softAuthenticator) authData(t *testing.T, attested bool) []byte {
+	t.Helper()
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	a.signCount++
+
+	// User present and user verified, plus attested credential data on
+	// registration.
+	flags := byte(0x01 | 0x04)
+	if attested {
+		flags |= 0x40
+	}
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	return append(data, publicKey...)
+}
+
+func clientData(t *testing.T, ceremony string, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      testOrigin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// create answers navigator.credentials.create() for the given options.
+func (a *softAuthenticator) create(t *testing.T, challenge string, userHandle []byte) []byte {
+	t.Helper()
+	a.userHandle = userHandle
+
+	attestation, err := webauthncbor.Marshal(struct {
+		Format       string                 `cbor:"fmt"`
+		AttStatement map[string]interface{} `cbor:"attStmt"`
+		AuthData     []byte                 `cbor:"authData"`
+	}{"none", map[string]interface{}{}, a.authData(t, true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    b64(a.credentialID),
+		"rawId": b64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(clientData(t, "webauthn.create", challenge)),
+			"attestationObject": b64(attestation),
+			"transports":        []string{"internal"},
+		},
+		"clientExtensionResults": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// get answers navigator.credentials.get() for the given challenge.
+func (a *softAuthenticator) get(t *testing.T, challenge string) []byte {
+	t.Helper()
+	authData := a.authData(t, false)
+	client := clientData(t, "webauthn.get", challenge)
+
+	clientHash := sha256.Sum256(client)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    b64(a.credentialID),
+		"rawId": b64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(client),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(a.userHandle),
+		},
+		"clientExtensionResults": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+type ceremonyResponse struct {
+	Status int
+	Body   struct {
+		Message string `json:"message"`
+		Data    struct {
+			SessionID string `json:"sessionId"`
+			Options   struct {
+				PublicKey struct {
+					Challenge string `json:"challenge"`
+					User      struct {
+						ID string `json:"id"`
+					} `json:"user"`
+				} `json:"publicKey"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+}
+
+func call(t *testing.T, handler gin.HandlerFunc, userID string, target string, body []byte) ceremonyResponse {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if userID != "" {
+		c.Set("id", userID)
+	}
+
+	handler(c)
+
+	var response ceremonyResponse
+	response.Status = recorder.Code
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response.Body); err != nil {
+		t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+	}
+	return response
+}
+
+func setupPasskeyTest(t *testing.T) (*models.User, *memoryPasskeyStore, *[]*models.User) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("WEBAUTHN_RP_ID", testRPID)
+	t.Setenv("WEBAUTHN_RP_ORIGINS", testOrigin)
+
+	user := &models.User{ID: primitive.NewObjectID(), Email: "ada@example.test", FirstName: "Ada", LastName: "Lovelace"}
+	store := newMemoryPasskeyStore(user)
+
+	var loggedIn []*models.User
+	previousStore, previousComplete := passkeys, completePasskeyLogin
+	passkeys = store
+	completePasskeyLogin = func(c *gin.Context, user *models.User) {
+		loggedIn = append(loggedIn, user)
+		c.JSON(http.StatusOK, gin.H{"message": "Login successful"})
+	}
+	t.Cleanup(func() {
+		passkeys, completePasskeyLogin = previousStore, previousComplete
+	})
+
+	return user, store, &loggedIn
+}
+
+func registerPasskey(t *testing.T, user *models.User, authenticator *softAuthenticator) {
+	t.Helper()
+	begin := call(t, BeginPasskeyRegistration(), user.ID.Hex(), "/auth/passkeys/register/begin", nil)
+	if begin.Status != http.StatusOK {
+		t.Fatalf("begin registration: %d %s", begin.Status, begin.Body.Message)
+	}
+
+	userHandle, err := base64.RawURLEncoding.DecodeString(begin.Body.Data.Options.PublicKey.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := authenticator.create(t, begin.Body.Data.Options.PublicKey.Challenge, userHandle)
+	finish := call(t, FinishPasskeyRegistration(), user.ID.Hex(), "/auth/passkeys/register/finish?sessionId="+begin.Body.Data.SessionID, body)
+	if finish.Status != http.StatusCreated {
+		t.Fatalf("finish registration: %d %s", finish.Status, finish.Body.Message)
+	}
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	user, store, loggedIn := setupPasskeyTest(t)
+	authenticator := newSoftAuthenticator(t)
+
+	registerPasskey(t, user, authenticator)
+	if len(store.credentials) != 1 || !bytes.Equal(store.credentials[0].CredentialID, authenticator.credentialID) {
+		t.Fatalf("passkey was not stored: %+v", store.credentials)
+	}
+
+	begin := call(t, BeginPasskeyLogin(), "", "/auth/passkeys/login/begin", nil)
+	if begin.Status != http.StatusOK {
+		t.Fatalf("begin login: %d %s", begin.Status, begin.Body.Message)
+	}
+
+	body := authenticator.get(t, begin.Body.Data.Options.PublicKey.Challenge)
+	finish := call(t, FinishPasskeyLogin(), "", "/auth/passkeys/login/finish?sessionId="+begin.Body.Data.SessionID, body)
+	if finish.Status != http.StatusOK {
+		t.Fatalf("finish login: %d %s", finish.Status, finish.Body.Message)
+	}
+	if len(*loggedIn) != 1 || (*loggedIn)[0].ID != user.ID {
+		t.Fatalf("login completed for %+v, want %s", *loggedIn, user.ID.Hex())
+	}
+	if store.credentials[0].Credential.Authenticator.SignCount != authenticator.signCount {
+		t.Errorf("sign count = %d, want %d", store.credentials[0].Credential.Authenticator.SignCount, authenticator.signCount)
+	}
+}
+
+func TestPasskeyLoginRejectsWrongChallenge(t *testing.T) {
+	user, _, loggedIn := setupPasskeyTest(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, user, authenticator)
+
+	begin := call(t, BeginPasskeyLogin(), "", "/auth/passkeys/login/begin", nil)
+	body := authenticator.get(t, b64([]byte("not the challenge we were sent")))
+	finish := call(t, FinishPasskeyLogin(), "", "/auth/passkeys/login/finish?sessionId="+begin.Body.Data.SessionID, body)
+	if finish.Status != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", finish.Status, http.StatusUnauthorized)
+	}
+	if len(*loggedIn) != 0 {
+		t.Fatal("login completed with a wrong challenge")
+	}
+}
+
+func TestPasskeyLoginRejectsUnknownKey(t *testing.T) {
+	user, _, loggedIn := setupPasskeyTest(t)
+	registered := newSoftAuthenticator(t)
+	registerPasskey(t, user, registered)
+
+	// Same credential ID, different private key.
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID = registered.credentialID
+	impostor.userHandle = registered.userHandle
+
+	begin := call(t, BeginPasskeyLogin(), "", "/auth/passkeys/login/begin", nil)
+	body := impostor.get(t, begin.Body.Data.Options.PublicKey.Challenge)
+	finish := call(t, FinishPasskeyLogin(), "", "/auth/passkeys/login/finish?sessionId="+begin.Body.Data.SessionID, body)
+	if finish.Status != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", finish.Status, http.StatusUnauthorized)
+	}
+	if len(*loggedIn) != 0 {
+		t.Fatal("login completed with a signature from the wrong key")
+	}
+}
+
+func TestPasskeyRegistrationRejectsOtherUsersSession(t *testing.T) {
+	user, store, _ := setupPasskeyTest(t)
+	other := &models.User{ID: primitive.NewObjectID(), Email: "eve@example.test"}
+	store.users[other.ID.Hex()] = other
+
+	begin := call(t, BeginPasskeyRegistration(), user.ID.Hex(), "/auth/passkeys/register/begin", nil)
+	userHandle, _ := base64.RawURLEncoding.DecodeString(begin.Body.Data.Options.PublicKey.User.ID)
+	body := newSoftAuthenticator(t).create(t, begin.Body.Data.Options.PublicKey.Challenge, userHandle)
+
+	finish := call(t, FinishPasskeyRegistration(), other.ID.Hex(), "/auth/passkeys/register/finish?sessionId="+begin.Body.Data.SessionID, body)
+	if finish.Status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", finish.Status, http.StatusBadRequest)
+	}
+	if len(store.credentials) != 0 {
+		t.Fatal("passkey stored for another user's registration session")
+	}
+}
+
+// TestPasskeyLoginWithMongoStore runs against the default store wiring. With
+// no session stored (or no database reachable) the lookup must fail cleanly
+// instead of crashing the handler.
+func TestPasskeyLoginWithMongoStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("WEBAUTHN_RP_ID", testRPID)
+	t.Setenv("WEBAUTHN_RP_ORIGINS", testOrigin)
+	if _, ok := passkeys.(mongoPasskeyStore); !ok {
+		t.Fatalf("default passkey store is %T, want mongoPasskeyStore", passkeys)
+	}
+
+	finish := call(t, FinishPasskeyLogin(), "", "/auth/passkeys/login/finish?sessionId=missing", nil)
+	if finish.Status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", finish.Status, http.StatusBadRequest)
+	}
+}
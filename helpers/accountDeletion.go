@@ -0,0 +1,70 @@
+package helpers
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+	"udo-golang/queries"
+)
+
+// AccountDeletionGracePeriod is how long a deactivated account waits before
+// it is purged. Signing in during that time cancels the deletion.
+func AccountDeletionGracePeriod() time.Duration {
+	return envDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+}
+
+// anonymizeDeletedAccounts reports whether deleted accounts are anonymized
+// rather than removed, as chosen by ACCOUNT_DELETION_MODE.
+func anonymizeDeletedAccounts() bool {
+	return os.Getenv("ACCOUNT_DELETION_MODE") == "anonymize"
+}
+
+// StartAccountPurge periodically deletes accounts whose grace period has
+// ended. Running it on several instances is safe: each account is purged
+// once.
+func StartAccountPurge() {
+	go func() {
+		ticker := time.NewTicker(envDuration("ACCOUNT_PURGE_INTERVAL", time.Hour))
+		defer ticker.Stop()
+
+		for {
+			purgeDueAccounts()
+			<-ticker.C
+		}
+	}()
+}
+
+func purgeDueAccounts() {
+	anonymize := anonymizeDeletedAccounts()
+
+	for {
+		users, err := queries.GetUsersDueForDeletion(100)
+		if err != nil {
+			log.Printf("Failed to fetch accounts due for deletion: %v", err)
+			return
+		}
+		if len(users) == 0 {
+			return
+		}
+
+		purged := 0
+		for _, user := range users {
+			err := queries.PurgeUser(user.ID, anonymize)
+			if errors.Is(err, queries.ErrDeletionCancelled) {
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to purge account %s: %v", user.ID.Hex(), err)
+				continue
+			}
+			purged++
+			log.Printf("Purged account %s", user.ID.Hex())
+		}
+
+		// Stop rather than spin on accounts that keep failing.
+		if purged == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2Params are the argon2id cost parameters, encoded into every hash in
+// the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  int
+	KeyLength   int
+}
+
+// argon2Config reads ARGON2_MEMORY (KiB), ARGON2_ITERATIONS and
+// ARGON2_PARALLELISM. The defaults follow the OWASP recommendation.
+func argon2Config() argon2Params {
+	return argon2Params{
+		Memory:      uint32(envInt("ARGON2_MEMORY", 64*1024)),
+		Iterations:  uint32(envInt("ARGON2_ITERATIONS", 3)),
+		Parallelism: uint8(envInt("ARGON2_PARALLELISM", 2)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+type argon2idHasher struct{}
+
+func (argon2idHasher) Name() string {
+	return "argon2id"
+}
+
+func (argon2idHasher) Hash(password string) (string, error) {
+	params := argon2Config()
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(params.KeyLength))
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (argon2idHasher) Verify(password string, hash string) (bool, error) {
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+func (argon2idHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (argon2idHasher) Outdated(hash string) bool {
+	params, _, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+
+	current := argon2Config()
+	return params.Memory < current.Memory ||
+		params.Iterations < current.Iterations ||
+		params.Parallelism < current.Parallelism ||
+		len(key) < current.KeyLength
+}
+
+func decodeArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+
+	return params, salt, key, nil
+}
@@ -1,24 +1,48 @@
 package helpers
 
 import (
+	"errors"
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+// bcryptHasher hashes with bcrypt at BCRYPT_COST, 12 by default.
+type bcryptHasher struct{}
+
+func bcryptCost() int {
+	cost := envInt("BCRYPT_COST", 12)
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return 12
+	}
+	return cost
+}
+
+func (bcryptHasher) Name() string {
+	return "bcrypt"
+}
+
+func (bcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost())
 	if err != nil {
 		return "", err
 	}
 	return string(bytes), nil
 }
 
-func VerifyPassword(userPassword string, providedPassword string) (bool, string) {
-	err := bcrypt.CompareHashAndPassword([]byte(providedPassword), []byte(userPassword))
-	check := true
-	msg := ""
-	if err != nil {
-		msg = "email or password is incorrect"
-		check = false
+func (bcryptHasher) Verify(password string, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
 	}
-	return check, msg
+	return err == nil, err
+}
+
+func (bcryptHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (bcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < bcryptCost()
 }
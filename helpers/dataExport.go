@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"log"
+	"time"
+	"udo-golang/queries"
+)
+
+// DataExportTTL is how long a finished data export can be downloaded.
+func DataExportTTL() time.Duration {
+	return envDuration("DATA_EXPORT_TTL", 7*24*time.Hour)
+}
+
+// DataExportBuildTimeout is how long an export may stay pending before it is
+// taken to have stalled, e.g. because the instance building it restarted.
+func DataExportBuildTimeout() time.Duration {
+	return envDuration("DATA_EXPORT_BUILD_TIMEOUT", 30*time.Minute)
+}
+
+// StartDataExportCleanup periodically fails stalled exports, so they stop
+// blocking new requests, and deletes the archives of expired ones.
+func StartDataExportCleanup() {
+	go func() {
+		ticker := time.NewTicker(envDuration("DATA_EXPORT_CLEANUP_INTERVAL", 15*time.Minute))
+		defer ticker.Stop()
+
+		for {
+			cleanUpDataExports()
+			<-ticker.C
+		}
+	}()
+}
+
+func cleanUpDataExports() {
+	failed, err := queries.FailStaleDataExports(time.Now().Add(-DataExportBuildTimeout()))
+	if err != nil {
+		log.Printf("Failed to fail stale data exports: %v", err)
+	} else if failed > 0 {
+		log.Printf("Failed %d stalled data exports", failed)
+	}
+
+	deleted, err := queries.DeleteExpiredDataExportArchives()
+	if err != nil {
+		log.Printf("Failed to delete expired data export archives: %v", err)
+	} else if deleted > 0 {
+		log.Printf("Deleted %d expired data export archives", deleted)
+	}
+}
@@ -0,0 +1,106 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// GoogleKeySource supplies the keys Google signs ID tokens with. Tests can
+// swap it for a StaticKeySource built from a local key set.
+var GoogleKeySource KeySource = NewRemoteKeySource(googleCertsURL)
+
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// GoogleClaims are the ID token claims we rely on.
+type GoogleClaims struct {
+	Email         string       `json:"email"`
+	EmailVerified FlexibleBool `json:"email_verified"`
+	Name          string       `json:"name"`
+	GivenName     string       `json:"given_name"`
+	FamilyName    string       `json:"family_name"`
+	Picture       string       `json:"picture"`
+	jwt.StandardClaims
+}
+
+// FlexibleBool accepts both true and "true"; Google and Apple have sent
+// either form for email_verified.
+type FlexibleBool bool
+
+func (b *FlexibleBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = FlexibleBool(v)
+	case string:
+		*b = FlexibleBool(v == "true")
+	}
+	return nil
+}
+
+// googleClientIDs reads GOOGLE_CLIENT_ID, a comma separated list so the web
+// and mobile clients can share the endpoint.
+func googleClientIDs() []string {
+	var ids []string
+	for _, id := range strings.Split(os.Getenv("GOOGLE_CLIENT_ID"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// VerifyGoogleIDToken checks an ID token's signature against Google's keys
+// and that it was issued by Google to one of our client IDs for a verified
+// email address.
+func VerifyGoogleIDToken(idToken string) (*GoogleClaims, error) {
+	clientIDs := googleClientIDs()
+	if len(clientIDs) == 0 {
+		return nil, errors.New("google sign-in is not configured")
+	}
+
+	claims := &GoogleClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return GoogleKeySource.Key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Google ID token: %w", err)
+	}
+
+	if !containsString(googleIssuers, claims.Issuer) {
+		return nil, errors.New("invalid Google ID token: unexpected issuer")
+	}
+	if !containsString(clientIDs, claims.Audience) {
+		return nil, errors.New("invalid Google ID token: issued to another client")
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, errors.New("invalid Google ID token: missing expiry")
+	}
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return nil, errors.New("the Google account email is not verified")
+	}
+
+	return claims, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testGoogleClientID = "web-client.apps.googleusercontent.com"
+	testGoogleKid      = "google-key-1"
+)
+
+func setupGoogleTest(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := GoogleKeySource
+	GoogleKeySource = StaticKeySource{testGoogleKid: &key.PublicKey}
+	t.Cleanup(func() { GoogleKeySource = previous })
+	t.Setenv("GOOGLE_CLIENT_ID", "mobile-client.apps.googleusercontent.com, "+testGoogleClientID)
+
+	return key
+}
+
+func googleIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func googleTestClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            testGoogleClientID,
+		"sub":            "1234567890",
+		"email":          "ada@example.test",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifyGoogleIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		kid    string
+		modify func(claims jwt.MapClaims)
+		want   string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:   "issuer without scheme",
+			modify: func(claims jwt.MapClaims) { claims["iss"] = "accounts.google.com" },
+		},
+		{
+			name:   "email_verified as string",
+			modify: func(claims jwt.MapClaims) { claims["email_verified"] = "true" },
+		},
+		{
+			name:   "wrong audience",
+			modify: func(claims jwt.MapClaims) { claims["aud"] = "another-client.apps.googleusercontent.com" },
+			want:   "issued to another client",
+		},
+		{
+			name:   "wrong issuer",
+			modify: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.test" },
+			want:   "unexpected issuer",
+		},
+		{
+			name:   "expired",
+			modify: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+			want:   "expired",
+		},
+		{
+			name:   "missing expiry",
+			modify: func(claims jwt.MapClaims) { delete(claims, "exp") },
+			want:   "missing expiry",
+		},
+		{
+			name: "unknown kid",
+			kid:  "google-key-2",
+			want: "unknown key ID",
+		},
+		{
+			name:   "email not verified",
+			modify: func(claims jwt.MapClaims) { claims["email_verified"] = false },
+			want:   "email is not verified",
+		},
+		{
+			name:   "email_verified string false",
+			modify: func(claims jwt.MapClaims) { claims["email_verified"] = "false" },
+			want:   "email is not verified",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := setupGoogleTest(t)
+
+			claims := googleTestClaims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			kid := testGoogleKid
+			if tt.kid != "" {
+				kid = tt.kid
+			}
+
+			verified, err := VerifyGoogleIDToken(googleIDToken(t, key, kid, claims))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("VerifyGoogleIDToken: %v", err)
+				}
+				if verified.Email != "ada@example.test" {
+					t.Errorf("email = %q, want ada@example.test", verified.Email)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyGoogleIDTokenRejectsOtherSigningKey(t *testing.T) {
+	setupGoogleTest(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyGoogleIDToken(googleIDToken(t, other, testGoogleKid, googleTestClaims())); err == nil {
+		t.Fatal("accepted a token signed by another key")
+	}
+}
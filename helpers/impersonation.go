@@ -0,0 +1,63 @@
+package helpers
+
+import (
+	"time"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Actor is the "act" claim (RFC 8693) of an impersonation token.
+type Actor struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Version int    `json:"ver"`
+}
+
+// ImpersonationTTL is how long an impersonation token lives. There is no
+// refresh token; support staff ask for a new one.
+func ImpersonationTTL() time.Duration {
+	return envDuration("IMPERSONATION_TTL", 15*time.Minute)
+}
+
+// GenerateImpersonationToken signs an access token that lets admin act as
+// user. It carries the user's claims plus an act claim naming the admin.
+func GenerateImpersonationToken(user *models.User, admin *models.User) (string, *SignedDetails, error) {
+	now := time.Now()
+	claims := &SignedDetails{
+		Email:   user.Email,
+		ID:      user.ID.Hex(),
+		IsAdmin: user.IsAdmin,
+		Version: user.TokenVersion,
+		Actor: &Actor{
+			Subject: admin.ID.Hex(),
+			Email:   admin.Email,
+			Version: admin.TokenVersion,
+		},
+		StandardClaims: jwt.StandardClaims{
+			Id:        NewTokenID(),
+			ExpiresAt: now.Add(ImpersonationTTL()).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+	}
+
+	token, err := signClaims(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// checkActorRevocation ends an impersonation once the admin behind it loses
+// the admin role or logs out of all sessions.
+func checkActorRevocation(actor *Actor) string {
+	admin, err := queries.GetUserByID(actor.Subject)
+	if err != nil || !admin.IsAdmin {
+		return "The token is invalid"
+	}
+	if admin.TokenVersion != actor.Version {
+		return "Token has been revoked"
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeySource resolves the public key a third party signed a token with.
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeySource is a fixed set of keys, e.g. a local JWKS used in tests.
+type StaticKeySource map[string]crypto.PublicKey
+
+func (s StaticKeySource) Key(kid string) (crypto.PublicKey, error) {
+	key, ok := s[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+// NewStaticKeySource builds a key source from a parsed JWKS document. Keys
+// that cannot verify signatures, such as encryption or symmetric keys, are
+// skipped; it only fails when no signing key is left.
+func NewStaticKeySource(set JWKSet) (StaticKeySource, error) {
+	source := StaticKeySource{}
+	var skipped error
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			skipped = err
+			continue
+		}
+		source[jwk.Kid] = key
+	}
+	if len(source) == 0 {
+		if skipped != nil {
+			return nil, fmt.Errorf("no usable signing keys in JWKS: %w", skipped)
+		}
+		return nil, errors.New("no usable signing keys in JWKS")
+	}
+	return source, nil
+}
+
+// RemoteKeySource fetches a JWKS document over HTTPS and caches it for as
+// long as the response's Cache-Control max-age allows. An unknown kid forces
+// a refresh, at most once a minute, so key rotations are picked up early.
+type RemoteKeySource struct {
+	URL    string
+	Client *http.Client
+
+	mu          sync.Mutex
+	keys        StaticKeySource
+	expiresAt   time.Time
+	lastFetched time.Time
+}
+
+func NewRemoteKeySource(url string) *RemoteKeySource {
+	return &RemoteKeySource{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *RemoteKeySource) Key(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.keys == nil || now.After(s.expiresAt) {
+		if err := s.fetch(now); err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	if now.Sub(s.lastFetched) > time.Minute {
+		if err := s.fetch(now); err != nil {
+			return nil, err
+		}
+	}
+	return s.keys.Key(kid)
+}
+
+func (s *RemoteKeySource) fetch(now time.Time) error {
+	s.lastFetched = now
+
+	resp, err := s.Client.Get(s.URL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys, err := NewStaticKeySource(set)
+	if err != nil {
+		return err
+	}
+
+	s.keys = keys
+	s.expiresAt = now.Add(cacheMaxAge(resp.Header.Get("Cache-Control"), time.Hour))
+	return nil
+}
+
+func cacheMaxAge(header string, fallback time.Duration) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age="); ok {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return fallback
+}
+
+// PublicKey decodes an RSA or EC key from its JWK form.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for kid %s: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for kid %s: %w", k.Kid, err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q for kid %s", k.Crv, k.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate for kid %s: %w", k.Kid, err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate for kid %s: %w", k.Kid, err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q for kid %s", k.Kty, k.Kid)
+	}
+}
@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func ecJWK(t *testing.T, kid string) JWK {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return JWK{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.Bytes()),
+	}
+}
+
+func TestNewStaticKeySourceSkipsUnusableKeys(t *testing.T) {
+	encryption := ecJWK(t, "enc-key")
+	encryption.Use = "enc"
+
+	source, err := NewStaticKeySource(JWKSet{Keys: []JWK{
+		encryption,
+		{Kty: "oct", Kid: "hmac-key", Use: "sig"},
+		{Kty: "EC", Kid: "odd-curve", Crv: "secp256k1"},
+		ecJWK(t, "sig-key"),
+	}})
+	if err != nil {
+		t.Fatalf("NewStaticKeySource: %v", err)
+	}
+
+	if _, err := source.Key("sig-key"); err != nil {
+		t.Errorf("signing key missing: %v", err)
+	}
+	for _, kid := range []string{"enc-key", "hmac-key", "odd-curve"} {
+		if _, err := source.Key(kid); err == nil {
+			t.Errorf("unusable key %q was kept", kid)
+		}
+	}
+}
+
+func TestNewStaticKeySourceFailsWithoutSigningKeys(t *testing.T) {
+	encryption := ecJWK(t, "enc-key")
+	encryption.Use = "enc"
+
+	if _, err := NewStaticKeySource(JWKSet{Keys: []JWK{encryption, {Kty: "oct", Kid: "hmac-key"}}}); err == nil {
+		t.Fatal("accepted a JWKS without signing keys")
+	}
+	if _, err := NewStaticKeySource(JWKSet{}); err == nil {
+		t.Fatal("accepted an empty JWKS")
+	}
+}
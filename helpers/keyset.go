@@ -0,0 +1,533 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// SigningKey is one entry of the local JWT keyset. Only the newest key that
+// has not been retired signs tokens; retired keys are kept for verification
+// until every token they could have signed has expired.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	CreatedAt time.Time
+	RetiredAt *time.Time
+}
+
+// JWK is the public half of a signing key as published in the JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type storedKey struct {
+	ID         string     `json:"kid"`
+	Algorithm  string     `json:"alg"`
+	PrivateKey string     `json:"privateKey"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RetiredAt  *time.Time `json:"retiredAt,omitempty"`
+}
+
+// storedKeySet is the keyset file. CreatedAt is when the service moved off
+// the legacy HS256 secret, which bounds how long legacy tokens are honoured.
+type storedKeySet struct {
+	CreatedAt time.Time   `json:"createdAt"`
+	Keys      []storedKey `json:"keys"`
+}
+
+type keySet struct {
+	mu        sync.RWMutex
+	keys      []*SigningKey
+	createdAt time.Time
+	// legacyFile is set when the file predates storedKeySet and should be
+	// rewritten so its creation time stops shifting as keys are pruned.
+	legacyFile bool
+
+	reloadMu   sync.Mutex
+	reloadedAt time.Time
+}
+
+// keySetReloadInterval limits how often an unknown kid makes us re-read the
+// keyset file, so tokens with made-up kids cannot keep us busy reading it.
+const keySetReloadInterval = 10 * time.Second
+
+// keySetLockStale is how old a lock file must be before it is taken to be
+// left over from an instance that crashed while holding it.
+const keySetLockStale = time.Minute
+
+var keys = &keySet{}
+
+func keySetPath() string {
+	if path := os.Getenv("JWT_KEYSET_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join("keys", "jwt-keyset.json")
+}
+
+func signingAlgorithm() string {
+	if alg := os.Getenv("JWT_SIGNING_ALG"); alg != "" {
+		return alg
+	}
+	return "RS256"
+}
+
+func keyRotationInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("JWT_KEY_ROTATION_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return 30 * 24 * time.Hour
+}
+
+// InitKeySet loads the keyset from disk, creating it or rotating the active
+// key when needed. It must be called before any token is signed.
+func InitKeySet() error {
+	return keys.rotateIfDue()
+}
+
+// StartKeyRotation periodically rotates the active signing key and drops
+// retired keys that can no longer verify a live token.
+func StartKeyRotation() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := keys.rotateIfDue(); err != nil {
+				log.Printf("Failed to rotate JWT signing key: %v", err)
+			}
+		}
+	}()
+}
+
+// PublicJWKS returns the public keys that currently verify our tokens.
+func PublicJWKS() JWKSet {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range keys.keys {
+		set.Keys = append(set.Keys, publicJWK(key))
+	}
+	return set
+}
+
+func publicJWK(key *SigningKey) JWK {
+	jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+
+	switch pub := key.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return jwk
+}
+
+func (ks *keySet) active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if ks.keys[i].RetiredAt == nil {
+			return ks.keys[i]
+		}
+	}
+	return nil
+}
+
+func (ks *keySet) lookup(kid string) *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// lookupOrReload is lookup that re-reads the keyset file when kid is
+// unknown, since another instance sharing the file may have just rotated.
+func (ks *keySet) lookupOrReload(kid string) *SigningKey {
+	if key := ks.lookup(kid); key != nil {
+		return key
+	}
+
+	ks.reloadMu.Lock()
+	if time.Since(ks.reloadedAt) < keySetReloadInterval {
+		ks.reloadMu.Unlock()
+		return nil
+	}
+	ks.reloadedAt = time.Now()
+	ks.reloadMu.Unlock()
+
+	if err := ks.load(); err != nil {
+		log.Printf("Failed to reload JWT keyset: %v", err)
+		return nil
+	}
+	return ks.lookup(kid)
+}
+
+func (ks *keySet) load() error {
+	data, err := os.ReadFile(keySetPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read JWT keyset: %w", err)
+	}
+
+	var stored storedKeySet
+	legacyFile := bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+	if legacyFile {
+		// Keysets written before the creation time was recorded are a bare
+		// array; their oldest key is the best estimate of it.
+		if err := json.Unmarshal(data, &stored.Keys); err != nil {
+			return fmt.Errorf("failed to decode JWT keyset: %w", err)
+		}
+		for _, s := range stored.Keys {
+			if stored.CreatedAt.IsZero() || s.CreatedAt.Before(stored.CreatedAt) {
+				stored.CreatedAt = s.CreatedAt
+			}
+		}
+	} else if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to decode JWT keyset: %w", err)
+	}
+
+	loaded := make([]*SigningKey, 0, len(stored.Keys))
+	for _, s := range stored.Keys {
+		block, _ := pem.Decode([]byte(s.PrivateKey))
+		if block == nil {
+			return fmt.Errorf("invalid private key for kid %s", s.ID)
+		}
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("invalid private key for kid %s: %w", s.ID, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("unsupported private key for kid %s", s.ID)
+		}
+		loaded = append(loaded, &SigningKey{
+			ID:        s.ID,
+			Algorithm: s.Algorithm,
+			Private:   signer,
+			CreatedAt: s.CreatedAt,
+			RetiredAt: s.RetiredAt,
+		})
+	}
+
+	ks.mu.Lock()
+	ks.keys = loaded
+	ks.createdAt = stored.CreatedAt
+	ks.legacyFile = legacyFile
+	ks.mu.Unlock()
+	return nil
+}
+
+func (ks *keySet) save() error {
+	stored := make([]storedKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+		if err != nil {
+			return fmt.Errorf("failed to encode private key %s: %w", key.ID, err)
+		}
+		stored = append(stored, storedKey{
+			ID:         key.ID,
+			Algorithm:  key.Algorithm,
+			PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			CreatedAt:  key.CreatedAt,
+			RetiredAt:  key.RetiredAt,
+		})
+	}
+
+	data, err := json.MarshalIndent(storedKeySet{CreatedAt: ks.createdAt, Keys: stored}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := keySetPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create keyset directory: %w", err)
+	}
+
+	// Write to a temporary file of our own first so a crash never leaves a
+	// half-written keyset, then swap it in atomically.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write JWT keyset: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write JWT keyset: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write JWT keyset: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write JWT keyset: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lockKeySet takes an exclusive lock on the keyset file by creating a lock
+// file next to it, so instances sharing the file never rotate at the same
+// time and overwrite each other's new key. The returned func releases it.
+func lockKeySet() (func(), error) {
+	path := keySetPath() + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create keyset directory: %w", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		lock, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			lock.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock JWT keyset: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > keySetLockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("failed to lock JWT keyset: timed out waiting for another instance")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// rotateIfDue adds a new signing key when there is none or the active one is
+// older than the rotation interval, and prunes keys retired long enough ago
+// that no token signed by them can still be valid. It holds the keyset lock
+// and starts from the file's current contents, so a rotation by another
+// instance sharing the file is picked up rather than overwritten.
+func (ks *keySet) rotateIfDue() error {
+	unlock, err := lockKeySet()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := ks.load(); err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	changed := ks.legacyFile
+	if ks.createdAt.IsZero() {
+		ks.createdAt = now
+		changed = true
+	}
+
+	var current *SigningKey
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if ks.keys[i].RetiredAt == nil {
+			current = ks.keys[i]
+			break
+		}
+	}
+
+	if current == nil || now.Sub(current.CreatedAt) >= keyRotationInterval() || current.Algorithm != signingAlgorithm() {
+		key, err := newSigningKey(signingAlgorithm())
+		if err != nil {
+			return err
+		}
+		for _, k := range ks.keys {
+			if k.RetiredAt == nil {
+				retiredAt := now
+				k.RetiredAt = &retiredAt
+			}
+		}
+		ks.keys = append(ks.keys, key)
+		changed = true
+		log.Printf("Rotated JWT signing key, new kid: %s", key.ID)
+	}
+
+	kept := ks.keys[:0]
+	for _, k := range ks.keys {
+		if k.RetiredAt != nil && now.Sub(*k.RetiredAt) > RefreshTokenTTL {
+			changed = true
+			continue
+		}
+		kept = append(kept, k)
+	}
+	ks.keys = kept
+
+	if !changed {
+		return nil
+	}
+	if err := ks.save(); err != nil {
+		return err
+	}
+	ks.legacyFile = false
+	return nil
+}
+
+func newSigningKey(algorithm string) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case "RS256":
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	return &SigningKey{
+		ID:        NewTokenID(),
+		Algorithm: algorithm,
+		Private:   signer,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// signClaims signs claims with the active key and sets its kid header.
+func signClaims(claims jwt.Claims) (string, error) {
+	key := keys.active()
+	if key == nil {
+		return "", errors.New("no active JWT signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// verificationKey is the jwt.Keyfunc for tokens we issued.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// Tokens minted before the move to asymmetric keys carry no kid.
+		// They are accepted while the old secret is set, but only if they
+		// could have been issued before the switch and not yet expired.
+		if token.Method == jwt.SigningMethodHS256 && SECRET_KEY != "" && keys.acceptsLegacy(token.Claims) {
+			return []byte(SECRET_KEY), nil
+		}
+		return nil, errors.New("missing key ID")
+	}
+
+	key := keys.lookupOrReload(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	if key.RetiredAt != nil && time.Since(*key.RetiredAt) > RefreshTokenTTL {
+		return nil, fmt.Errorf("key %q has been retired", kid)
+	}
+
+	return key.Private.Public(), nil
+}
+
+// acceptsLegacy reports whether claims may belong to a legacy HS256 token:
+// one issued before the keyset was created, while a token that old could
+// still be unexpired. Legacy tokens lived at most RefreshTokenTTL, so after
+// that the secret verifies nothing, even if it has leaked.
+func (ks *keySet) acceptsLegacy(claims jwt.Claims) bool {
+	details, ok := claims.(*SignedDetails)
+	if !ok || details.IssuedAt == 0 {
+		return false
+	}
+
+	ks.mu.RLock()
+	createdAt := ks.createdAt
+	ks.mu.RUnlock()
+
+	if createdAt.IsZero() || time.Since(createdAt) > RefreshTokenTTL {
+		return false
+	}
+	return !time.Unix(details.IssuedAt, 0).After(createdAt)
+}
+
+// signingMethodEdDSA adds Ed25519 support, which jwt-go v3 lacks.
+type signingMethodEdDSA struct{}
+
+func init() {
+	jwt.RegisterSigningMethod("EdDSA", func() jwt.SigningMethod {
+		return &signingMethodEdDSA{}
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return errors.New("ed25519: verification error")
+	}
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
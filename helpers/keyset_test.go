@@ -0,0 +1,146 @@
+package helpers
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func setupKeySetTest(t *testing.T) {
+	t.Helper()
+	t.Setenv("JWT_KEYSET_FILE", filepath.Join(t.TempDir(), "jwt-keyset.json"))
+	t.Setenv("JWT_SIGNING_ALG", "EdDSA")
+}
+
+func TestConcurrentRotationsKeepEveryKey(t *testing.T) {
+	setupKeySetTest(t)
+	if err := (&keySet{}).rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every rotation is due, as if all instances woke up at once.
+	t.Setenv("JWT_KEY_ROTATION_INTERVAL", "1ns")
+
+	instances := []*keySet{{}, {}, {}, {}}
+	var wg sync.WaitGroup
+	errs := make([]error, len(instances))
+	for i, instance := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = instance.rotateIfDue()
+		}()
+	}
+	wg.Wait()
+
+	onDisk := &keySet{}
+	if err := onDisk.load(); err != nil {
+		t.Fatal(err)
+	}
+	for i, instance := range instances {
+		if errs[i] != nil {
+			t.Fatalf("instance %d: %v", i, errs[i])
+		}
+		// Tokens signed by any instance's active key must verify everywhere.
+		if onDisk.lookup(instance.active().ID) == nil {
+			t.Errorf("instance %d's signing key was overwritten", i)
+		}
+	}
+}
+
+func TestUnknownKidReloadsKeySet(t *testing.T) {
+	setupKeySetTest(t)
+	stale := &keySet{}
+	if err := stale.rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_KEY_ROTATION_INTERVAL", "1ns")
+	rotated := &keySet{}
+	if err := rotated.rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	kid := rotated.active().ID
+
+	if stale.lookup(kid) != nil {
+		t.Fatal("stale instance already knows the new key")
+	}
+	if stale.lookupOrReload(kid) == nil {
+		t.Fatal("unknown kid did not reload the keyset")
+	}
+
+	// Reloads are rate limited, so a second unknown kid right away is not
+	// looked up on disk.
+	if err := rotated.rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	if stale.lookupOrReload(rotated.active().ID) != nil {
+		t.Fatal("reload was not rate limited")
+	}
+}
+
+func legacyToken(t *testing.T, issuedAt time.Time) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &SignedDetails{
+		ID: "5f0000000000000000000001",
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  issuedAt.Unix(),
+			ExpiresAt: issuedAt.Add(RefreshTokenTTL).Unix(),
+		},
+	}).SignedString([]byte(SECRET_KEY))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestLegacyTokensOnlyBeforeKeySetCutoff(t *testing.T) {
+	setupKeySetTest(t)
+	previousSecret, previousKeys := SECRET_KEY, keys
+	SECRET_KEY = "legacy-secret"
+	t.Cleanup(func() { SECRET_KEY, keys = previousSecret, previousKeys })
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		issuedAt  time.Time
+		valid     bool
+	}{
+		{"issued before the switch", now.Add(-time.Hour), now.Add(-2 * time.Hour), true},
+		{"issued after the switch", now.Add(-time.Hour), now.Add(-time.Minute), false},
+		{"switch longer ago than any legacy lifetime", now.Add(-RefreshTokenTTL - time.Hour), now.Add(-RefreshTokenTTL - 2*time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys = &keySet{createdAt: tt.createdAt}
+			_, msg := parseToken(legacyToken(t, tt.issuedAt))
+			if valid := msg == ""; valid != tt.valid {
+				t.Fatalf("valid = %v (%s), want %v", valid, msg, tt.valid)
+			}
+		})
+	}
+}
+
+func TestKeySetCreationTimeIsPersisted(t *testing.T) {
+	setupKeySetTest(t)
+	created := &keySet{}
+	if err := created.rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	if created.createdAt.IsZero() {
+		t.Fatal("creation time not set")
+	}
+
+	loaded := &keySet{}
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.createdAt.Equal(created.createdAt) {
+		t.Fatalf("createdAt = %v, want %v", loaded.createdAt, created.createdAt)
+	}
+}
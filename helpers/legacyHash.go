@@ -0,0 +1,142 @@
+package helpers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Imported users keep the hash from the system they came from until their
+// first successful login, when it is replaced by a native one. These schemes
+// can only verify; they never produce new hashes.
+var importedPasswordHashers = []PasswordHasher{
+	pbkdf2SHA256Hasher{},
+	firebaseScryptHasher{},
+}
+
+var errImportOnly = errors.New("hash scheme is only supported for imported passwords")
+
+// pbkdf2SHA256Hasher verifies hashes in the Django format:
+// pbkdf2_sha256$<iterations>$<salt>$<base64 key>
+type pbkdf2SHA256Hasher struct{}
+
+func (pbkdf2SHA256Hasher) Name() string {
+	return "pbkdf2_sha256"
+}
+
+func (pbkdf2SHA256Hasher) Hash(password string) (string, error) {
+	return "", errImportOnly
+}
+
+func (pbkdf2SHA256Hasher) Verify(password string, hash string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return false, errors.New("invalid pbkdf2_sha256 hash")
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false, errors.New("invalid pbkdf2_sha256 iteration count")
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, fmt.Errorf("invalid pbkdf2_sha256 key: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, []byte(parts[2]), iterations, len(expected))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+func (pbkdf2SHA256Hasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "pbkdf2_sha256$")
+}
+
+func (pbkdf2SHA256Hasher) Outdated(hash string) bool {
+	return true
+}
+
+// firebaseScryptHasher verifies hashes exported from Firebase Authentication,
+// stored as:
+// $firebase-scrypt$r=<rounds>,m=<mem cost>$<base64 salt>$<base64 hash>
+// The project-wide signer key and salt separator from the Firebase console
+// are read from FIREBASE_SCRYPT_SIGNER_KEY and FIREBASE_SCRYPT_SALT_SEPARATOR.
+type firebaseScryptHasher struct{}
+
+func (firebaseScryptHasher) Name() string {
+	return "firebase-scrypt"
+}
+
+func (firebaseScryptHasher) Hash(password string) (string, error) {
+	return "", errImportOnly
+}
+
+func (firebaseScryptHasher) Verify(password string, hash string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[1] != "firebase-scrypt" {
+		return false, errors.New("invalid firebase-scrypt hash")
+	}
+
+	var rounds, memCost int
+	if _, err := fmt.Sscanf(parts[2], "r=%d,m=%d", &rounds, &memCost); err != nil {
+		return false, fmt.Errorf("invalid firebase-scrypt parameters: %w", err)
+	}
+	if rounds < 1 || memCost < 1 || memCost > 20 {
+		return false, errors.New("invalid firebase-scrypt parameters")
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, fmt.Errorf("invalid firebase-scrypt salt: %w", err)
+	}
+	expected, err := base64.StdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("invalid firebase-scrypt hash: %w", err)
+	}
+
+	signerKey, err := base64.StdEncoding.DecodeString(os.Getenv("FIREBASE_SCRYPT_SIGNER_KEY"))
+	if err != nil || len(signerKey) == 0 {
+		return false, errors.New("FIREBASE_SCRYPT_SIGNER_KEY is not set or invalid")
+	}
+	separator, err := base64.StdEncoding.DecodeString(os.Getenv("FIREBASE_SCRYPT_SALT_SEPARATOR"))
+	if err != nil {
+		return false, errors.New("FIREBASE_SCRYPT_SALT_SEPARATOR is invalid")
+	}
+
+	// Firebase derives an AES-256 key with scrypt and uses it to encrypt
+	// the signer key in CTR mode with a zero IV; that ciphertext is the hash.
+	derived, err := scrypt.Key([]byte(password), append(salt, separator...), 1<<memCost, rounds, 1, 32)
+	if err != nil {
+		return false, err
+	}
+
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return false, err
+	}
+	candidate := make([]byte, len(signerKey))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(candidate, signerKey)
+
+	return subtle.ConstantTimeCompare(candidate, expected) == 1, nil
+}
+
+func (firebaseScryptHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$firebase-scrypt$")
+}
+
+func (firebaseScryptHasher) Outdated(hash string) bool {
+	return true
+}
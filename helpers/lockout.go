@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// LockoutPolicy controls how failed authentication attempts are throttled.
+// After DelayAfter consecutive failures each further attempt must wait an
+// exponentially growing delay, and after MaxAttempts the account is locked
+// for LockoutDuration. Failures from a single IP are counted separately,
+// across all accounts, within IPWindow. A MaxAttempts or IPMaxAttempts of 0
+// turns that lockout off.
+type LockoutPolicy struct {
+	DelayAfter      int
+	MaxAttempts     int
+	BaseDelay       time.Duration
+	LockoutDuration time.Duration
+	IPMaxAttempts   int
+	IPWindow        time.Duration
+}
+
+// GetLockoutPolicy reads the policy from the AUTH_* environment variables,
+// falling back to defaults for anything unset or invalid.
+func GetLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		DelayAfter:      envNonNegativeInt("AUTH_DELAY_AFTER", 3),
+		MaxAttempts:     envNonNegativeInt("AUTH_MAX_FAILED_ATTEMPTS", 10),
+		BaseDelay:       envDuration("AUTH_BASE_DELAY", time.Second),
+		LockoutDuration: envDuration("AUTH_LOCKOUT_DURATION", 15*time.Minute),
+		IPMaxAttempts:   envNonNegativeInt("AUTH_IP_MAX_FAILED_ATTEMPTS", 50),
+		IPWindow:        envDuration("AUTH_IP_WINDOW", 15*time.Minute),
+	}
+}
+
+// RetryAfter returns how long the caller must wait before another attempt is
+// allowed, or zero if it may try now.
+func (p LockoutPolicy) RetryAfter(failures int, lastFailedAt *time.Time, lockedUntil *time.Time) time.Duration {
+	now := time.Now()
+
+	if lockedUntil != nil && lockedUntil.After(now) {
+		return lockedUntil.Sub(now)
+	}
+
+	if failures < p.DelayAfter || lastFailedAt == nil {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.DelayAfter; i < failures && delay < p.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > p.LockoutDuration {
+		delay = p.LockoutDuration
+	}
+
+	if wait := lastFailedAt.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// envNonNegativeInt is envInt for settings where 0 is meaningful, such as
+// turning a limit off.
+func envNonNegativeInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
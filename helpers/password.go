@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// PasswordHasher is one password hashing scheme. Hashes are self-describing:
+// each scheme recognises its own by prefix and records its parameters in the
+// hash, so several schemes and parameter sets can coexist in the database.
+type PasswordHasher interface {
+	// Name is the value of PASSWORD_HASH_ALGORITHM that selects the scheme.
+	Name() string
+	Hash(password string) (string, error)
+	Verify(password string, hash string) (bool, error)
+	// Recognizes reports whether hash was produced by this scheme.
+	Recognizes(hash string) bool
+	// Outdated reports whether hash used weaker parameters than the
+	// scheme is currently configured with.
+	Outdated(hash string) bool
+}
+
+// passwordHashers are the native schemes, tried in order when verifying a
+// hash; importedPasswordHashers in legacyHash.go are tried after them.
+var passwordHashers = []PasswordHasher{
+	argon2idHasher{},
+	bcryptHasher{},
+}
+
+// currentPasswordHasher is the scheme new hashes are made with, selected by
+// PASSWORD_HASH_ALGORITHM: "argon2id" (the default) or "bcrypt".
+func currentPasswordHasher() PasswordHasher {
+	name := strings.ToLower(os.Getenv("PASSWORD_HASH_ALGORITHM"))
+	for _, hasher := range passwordHashers {
+		if hasher.Name() == name {
+			return hasher
+		}
+	}
+	if name != "" {
+		log.Printf("Unknown PASSWORD_HASH_ALGORITHM %q, using argon2id", name)
+	}
+	return argon2idHasher{}
+}
+
+func hasherFor(hash string) PasswordHasher {
+	for _, hasher := range passwordHashers {
+		if hasher.Recognizes(hash) {
+			return hasher
+		}
+	}
+	for _, hasher := range importedPasswordHashers {
+		if hasher.Recognizes(hash) {
+			return hasher
+		}
+	}
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	return currentPasswordHasher().Hash(password)
+}
+
+// VerifyPassword checks userPassword against the stored hash in
+// providedPassword, using whichever scheme produced the hash.
+func VerifyPassword(userPassword string, providedPassword string) (bool, string) {
+	msg := "email or password is incorrect"
+
+	hasher := hasherFor(providedPassword)
+	if hasher == nil {
+		return false, msg
+	}
+
+	check, err := hasher.Verify(userPassword, providedPassword)
+	if err != nil {
+		log.Printf("Password verification error: %v", err)
+		return false, msg
+	}
+	if !check {
+		return false, msg
+	}
+	return true, ""
+}
+
+// PasswordNeedsRehash reports whether hash should be replaced after the next
+// successful login, because it uses another scheme than the current one or
+// outdated parameters.
+func PasswordNeedsRehash(hash string) bool {
+	current := currentPasswordHasher()
+	if !current.Recognizes(hash) {
+		return true
+	}
+	return current.Outdated(hash)
+}
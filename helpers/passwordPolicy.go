@@ -0,0 +1,343 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy holds the rules every new password must meet.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// MinStrength is the lowest acceptable EstimatePasswordStrength score;
+	// 0 accepts any.
+	MinStrength int
+	// HistorySize is how many previous passwords are remembered and may
+	// not be reused; 0 remembers none.
+	HistorySize int
+	// BreachedListFile is a sorted file of SHA-1 password hashes, one per
+	// line, in the format of the Have I Been Pwned offline download.
+	BreachedListFile string
+}
+
+// PasswordViolation is one reason a password was rejected.
+type PasswordViolation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// GetPasswordPolicy reads the policy from the environment. MaxLength
+// defaults to 72, the most bcrypt will hash.
+func GetPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        envInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:        envInt("PASSWORD_MAX_LENGTH", 72),
+		RequireUpper:     envBool("PASSWORD_REQUIRE_UPPER", true),
+		RequireLower:     envBool("PASSWORD_REQUIRE_LOWER", true),
+		RequireDigit:     envBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol:    envBool("PASSWORD_REQUIRE_SYMBOL", false),
+		MinStrength:      envNonNegativeInt("PASSWORD_MIN_STRENGTH", 2),
+		HistorySize:      envNonNegativeInt("PASSWORD_HISTORY_SIZE", 5),
+		BreachedListFile: os.Getenv("PASSWORD_BREACHED_LIST_FILE"),
+	}
+}
+
+// CheckPassword validates password for the given field against the policy.
+// personal holds the user's own details, such as name and email, which the
+// password must not contain. It returns nil when the password is acceptable.
+func (p PasswordPolicy) CheckPassword(field string, password string, personal ...string) []PasswordViolation {
+	var violations []PasswordViolation
+	add := func(code, message string) {
+		violations = append(violations, PasswordViolation{Field: field, Code: code, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add("too_short", fmt.Sprintf("Password must be at least %d characters", p.MinLength))
+	}
+	if length > p.MaxLength {
+		add("too_long", fmt.Sprintf("Password must be at most %d characters", p.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		add("missing_upper", "Password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		add("missing_lower", "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add("missing_digit", "Password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add("missing_symbol", "Password must contain a symbol")
+	}
+
+	lower := strings.ToLower(password)
+	for _, word := range bannedWords(personal) {
+		if strings.Contains(lower, word) {
+			add("contains_personal_info", "Password must not contain your name or email")
+			break
+		}
+	}
+
+	if EstimatePasswordStrength(password) < p.MinStrength {
+		add("too_weak", "Password is too easy to guess")
+	}
+
+	if p.BreachedListFile != "" {
+		breached, err := breachedPasswords(p.BreachedListFile).contains(password)
+		if err != nil {
+			log.Printf("Breached password check failed: %v", err)
+		} else if breached {
+			add("breached", "Password has appeared in a data breach, please choose another")
+		}
+	}
+
+	return violations
+}
+
+// bannedWords splits the user's details into lowercase words worth banning.
+// Very short fragments are skipped so they don't reject most passwords.
+func bannedWords(personal []string) []string {
+	var words []string
+	for _, value := range personal {
+		value = strings.ToLower(value)
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			value = local
+		}
+		for _, word := range strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if utf8.RuneCountInString(word) >= 3 {
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
+
+// EstimatePasswordStrength scores a password from 0 (trivial) to 4 (very
+// strong) by estimating its entropy from the character classes it uses, with
+// repeated characters and keyboard or alphabet runs counting for little.
+func EstimatePasswordStrength(password string) int {
+	runes := []rune(strings.ToLower(password))
+	if len(runes) == 0 || isCommonPassword(password) {
+		return 0
+	}
+
+	pool := 0
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if hasLower {
+		pool += 26
+	}
+	if hasUpper {
+		pool += 26
+	}
+	if hasDigit {
+		pool += 10
+	}
+	if hasSymbol {
+		pool += 33
+	}
+
+	// Characters that repeat or continue a run add almost nothing an
+	// attacker's rules would not guess.
+	effective := 1.0
+	for i := 1; i < len(runes); i++ {
+		if runes[i] == runes[i-1] || isSequential(runes[i-1], runes[i]) {
+			effective += 0.25
+		} else {
+			effective++
+		}
+	}
+
+	bits := effective * math.Log2(float64(pool))
+	switch {
+	case bits < 28:
+		return 0
+	case bits < 36:
+		return 1
+	case bits < 60:
+		return 2
+	case bits < 80:
+		return 3
+	default:
+		return 4
+	}
+}
+
+var commonPasswords = map[string]bool{
+	"password": true, "passw0rd": true, "qwerty": true, "letmein": true,
+	"welcome": true, "admin": true, "iloveyou": true, "monkey": true,
+	"dragon": true, "football": true, "baseball": true, "sunshine": true,
+	"princess": true, "master": true, "login": true, "abc": true,
+}
+
+// isCommonPassword catches the usual words behind a password once the
+// digits and symbols people tack on to satisfy composition rules are
+// stripped, e.g. "Password1!".
+func isCommonPassword(password string) bool {
+	core := strings.TrimRightFunc(strings.ToLower(password), func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	return core == "" || commonPasswords[core]
+}
+
+const keyboardRows = "qwertyuiop asdfghjkl zxcvbnm 1234567890"
+
+func isSequential(a, b rune) bool {
+	if b-a == 1 || a-b == 1 {
+		return true
+	}
+	i := strings.IndexRune(keyboardRows, a)
+	return i >= 0 && i+1 < len(keyboardRows) && rune(keyboardRows[i+1]) == b
+}
+
+// breachedList searches a sorted hash file in place, so even the full
+// multi-gigabyte list never has to be loaded into memory.
+type breachedList struct {
+	path string
+}
+
+var (
+	breachedListsMu sync.Mutex
+	breachedLists   = map[string]*breachedList{}
+)
+
+func breachedPasswords(path string) *breachedList {
+	breachedListsMu.Lock()
+	defer breachedListsMu.Unlock()
+
+	list, ok := breachedLists[path]
+	if !ok {
+		list = &breachedList{path: path}
+		breachedLists[path] = list
+	}
+	return list
+}
+
+func (l *breachedList) contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	// Binary search over byte offsets: each probe reads the first line
+	// starting at or after the offset.
+	low, high := int64(0), info.Size()
+	for low < high {
+		mid := (low + high) / 2
+		hash, next, err := hashFrom(file, mid)
+		if err != nil {
+			return false, err
+		}
+
+		if hash != nil && bytes.Compare(hash, target) < 0 {
+			low = next
+			continue
+		}
+		if hash != nil && bytes.Equal(hash, target) {
+			return true, nil
+		}
+		high = mid
+	}
+
+	return false, nil
+}
+
+// hashFrom returns the hash on the first line starting at or after offset,
+// and the offset of the line following it. hash is nil past the last line.
+func hashFrom(file *os.File, offset int64) ([]byte, int64, error) {
+	if offset == 0 {
+		return hashAt(file, 0)
+	}
+
+	// Reading from the byte before offset skips the rest of a line that
+	// offset falls inside, but nothing when offset starts a line.
+	reader := bufio.NewReader(io.NewSectionReader(file, offset-1, math.MaxInt64-offset))
+	skipped, err := reader.ReadBytes('\n')
+	if err == io.EOF {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	return hashAt(file, offset-1+int64(len(skipped)))
+}
+
+func hashAt(file *os.File, offset int64) ([]byte, int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, math.MaxInt64-offset))
+	line, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	if len(line) == 0 {
+		return nil, 0, nil
+	}
+
+	next := offset + int64(len(line))
+	line = bytes.TrimSpace(line)
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return bytes.ToUpper(line), next, nil
+}
+
+func envBool(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
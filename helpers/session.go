@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"log"
+	"strings"
+	"time"
+	"udo-golang/queries"
+)
+
+// sessionTouchInterval limits how often a session's last-seen time is
+// written, so that not every request becomes a write.
+const sessionTouchInterval = time.Minute
+
+func checkSession(id string) string {
+	session, err := queries.GetSession(id)
+	if err != nil {
+		return "Session has ended"
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return "Session has ended"
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		go func() {
+			if err := queries.TouchSession(session.ID); err != nil {
+				log.Printf("Failed to record session activity: %v", err)
+			}
+		}()
+	}
+
+	return ""
+}
+
+// DeviceName gives a short description of the device behind a user agent,
+// such as "Chrome on macOS", for users to recognise their sessions by.
+func DeviceName(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"firefox/", "Firefox"},
+		{"fxios/", "Firefox"},
+		{"crios/", "Chrome"},
+		{"chrome/", "Chrome"},
+		{"safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp/", "OkHttp"},
+		{"postman", "Postman"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := ""
+	for _, o := range []struct{ token, name string }{
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"android", "Android"},
+		{"windows", "Windows"},
+		{"mac os x", "macOS"},
+		{"macintosh", "macOS"},
+		{"cros", "ChromeOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown device"
+}
@@ -1,10 +1,13 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
 	"time"
+	"udo-golang/queries"
 
 	jwt "github.com/dgrijalva/jwt-go"
 )
@@ -13,53 +16,108 @@ type SignedDetails struct {
 	Email   string `json:"email"`
 	ID      string `json:"id"`
 	IsAdmin bool   `json:"isAdmin"`
+	Version int    `json:"ver"`
+	Type    string `json:"typ,omitempty"`
+	Family  string `json:"fam,omitempty"`
+	// Scopes limits what a credential may do. It is nil for a user's own
+	// session, which may do anything the user can.
+	Scopes []string `json:"scp,omitempty"`
+	// Service marks a token issued to a service account rather than a person.
+	// ID then holds the service account's ID.
+	Service bool `json:"svc,omitempty"`
+	// Session is the ID of the session a user token belongs to.
+	Session string `json:"sid,omitempty"`
+	// Actor names the admin acting as the user in an impersonation token.
+	Actor *Actor `json:"act,omitempty"`
 	jwt.StandardClaims
 }
 
+// TokenPair is a freshly signed access/refresh pair. RefreshClaims is returned
+// so callers can persist the refresh token's ID and family.
+type TokenPair struct {
+	Token         string
+	RefreshToken  string
+	RefreshClaims *SignedDetails
+}
+
+const (
+	AccessTokenTTL  = 3 * time.Hour
+	RefreshTokenTTL = 3 * 24 * time.Hour
+	MfaTokenTTL     = 5 * time.Minute
+	MagicLinkTTL    = 15 * time.Minute
+	ServiceTokenTTL = time.Hour
+
+	refreshTokenType = "refresh"
+	mfaTokenType     = "mfa"
+	magicTokenType   = "magic"
+	exportTokenType  = "export"
+)
+
+// SECRET_KEY is the legacy HS256 secret. New tokens are signed with the keyset
+// in keyset.go; the secret only verifies tokens issued before the switch.
 var SECRET_KEY = os.Getenv("JWT_SECRET_KEY")
 
-func GenerateAllTokens(email string, uid string, isAdmin bool) (signedToken string, signedRefreshToken string, err error) {
-	claims := &SignedDetails{
-		Email:   email,
-		ID:      uid,
-		IsAdmin: isAdmin,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(3 * time.Hour).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
+// NewTokenID returns a random identifier suitable for a jti or token family.
+func NewTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to read random bytes: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// GenerateAllTokens signs an access token and a single-use refresh token for
+// the subject described by details. The refresh token joins the given family,
+// or starts a new one when family is empty. Both tokens name the family as
+// their session.
+func GenerateAllTokens(details SignedDetails, family string) (*TokenPair, error) {
+	now := time.Now()
+	if family == "" {
+		family = NewTokenID()
+	}
+
+	claims := details
+	claims.Type = ""
+	claims.Family = ""
+	claims.Session = family
+	claims.StandardClaims = jwt.StandardClaims{
+		Id:        NewTokenID(),
+		ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+		IssuedAt:  now.Unix(),
 	}
 
 	// refresh token (expires in 3 days)
-	refreshClaims := &SignedDetails{
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(3 * 24 * time.Hour).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
+	refreshClaims := details
+	refreshClaims.Type = refreshTokenType
+	refreshClaims.Family = family
+	refreshClaims.Session = family
+	refreshClaims.StandardClaims = jwt.StandardClaims{
+		Id:        NewTokenID(),
+		ExpiresAt: now.Add(RefreshTokenTTL).Unix(),
+		IssuedAt:  now.Unix(),
 	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+	token, err := signClaims(&claims)
 	if err != nil {
 		log.Printf("Failed to sign access token: %v", err)
-		return "", "", err
+		return nil, err
 	}
 
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(SECRET_KEY))
+	refreshToken, err := signClaims(&refreshClaims)
 	if err != nil {
 		log.Printf("Failed to sign refresh token: %v", err)
-		return "", "", err
+		return nil, err
 	}
 
-	return token, refreshToken, nil
+	return &TokenPair{
+		Token:         token,
+		RefreshToken:  refreshToken,
+		RefreshClaims: &refreshClaims,
+	}, nil
 }
 
-func ValidateToken(signedToken string) (*SignedDetails, string) {
-	token, err := jwt.ParseWithClaims(
-		signedToken,
-		&SignedDetails{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(SECRET_KEY), nil
-		},
-	)
+func parseToken(signedToken string) (*SignedDetails, string) {
+	token, err := jwt.ParseWithClaims(signedToken, &SignedDetails{}, verificationKey)
 
 	if err != nil {
 		if ve, ok := err.(*jwt.ValidationError); ok {
@@ -83,19 +141,200 @@ func ValidateToken(signedToken string) (*SignedDetails, string) {
 	return claims, ""
 }
 
-func SignJWt(email, userID string, isAdmin bool) (string, error) {
-	claims := jwt.MapClaims{
-		"email":   email,
-		"id":      userID,
-		"isAdmin": isAdmin,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-		"iat":     time.Now().Unix(),
+// checkRevocation looks the token up in the revocation store: the jti
+// denylist filled by logout, the per-user token version bumped by logout-all
+// and the session the token belongs to.
+func checkRevocation(claims *SignedDetails) string {
+	if claims.Service {
+		return checkServiceRevocation(claims)
+	}
+
+	if claims.Id != "" {
+		revoked, err := queries.IsTokenRevoked(claims.Id)
+		if err != nil {
+			log.Printf("Token revocation check failed: %v", err)
+			return "Unable to validate token"
+		}
+		if revoked {
+			return "Token has been revoked"
+		}
+	}
+
+	user, err := queries.GetUserByID(claims.ID)
+	if err != nil {
+		return "The token is invalid"
+	}
+	if user.TokenVersion != claims.Version {
+		return "Token has been revoked"
+	}
+
+	if claims.Session != "" {
+		if msg := checkSession(claims.Session); msg != "" {
+			return msg
+		}
+	}
+
+	if claims.Actor != nil {
+		return checkActorRevocation(claims.Actor)
+	}
+
+	return ""
+}
+
+// ParseAccessToken checks an access token's signature and expiry without
+// consulting the revocation store. It must not be used to authenticate a
+// request; use ValidateToken for that.
+func ParseAccessToken(signedToken string) (*SignedDetails, string) {
+	claims, msg := parseToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if claims.Type != "" {
+		return nil, "The token is invalid"
+	}
+
+	return claims, ""
+}
+
+// ValidateToken validates an access token and checks that it has not been
+// revoked. Refresh tokens are rejected.
+func ValidateToken(signedToken string) (*SignedDetails, string) {
+	claims, msg := ParseAccessToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if msg := checkRevocation(claims); msg != "" {
+		return nil, msg
+	}
+
+	return claims, ""
+}
+
+// ValidateRefreshToken validates a refresh token. Callers must still consume
+// it from the refresh token store to enforce single use.
+func ValidateRefreshToken(signedToken string) (*SignedDetails, string) {
+	claims, msg := parseToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if claims.Type != refreshTokenType || claims.Id == "" || claims.Family == "" {
+		return nil, "The refresh token is invalid"
+	}
+
+	if msg := checkRevocation(claims); msg != "" {
+		return nil, msg
+	}
+
+	return claims, ""
+}
+
+// GenerateMfaToken signs the short-lived challenge returned by Login when the
+// user has two-factor authentication enabled. It only proves that the
+// password step succeeded and cannot be used as an access token.
+func GenerateMfaToken(uid string, version int) (string, error) {
+	now := time.Now()
+	claims := &SignedDetails{
+		ID:      uid,
+		Version: version,
+		Type:    mfaTokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        NewTokenID(),
+			ExpiresAt: now.Add(MfaTokenTTL).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+	}
+	return signClaims(claims)
+}
+
+func ValidateMfaToken(signedToken string) (*SignedDetails, string) {
+	claims, msg := parseToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if claims.Type != mfaTokenType {
+		return nil, "The MFA token is invalid"
+	}
+
+	if msg := checkRevocation(claims); msg != "" {
+		return nil, msg
+	}
+
+	return claims, ""
+}
+
+// GenerateMagicLinkToken signs the token embedded in an email sign-in link.
+// Its jti identifies the stored magic link record that enforces single use.
+func GenerateMagicLinkToken(uid string, version int) (string, *SignedDetails, error) {
+	now := time.Now()
+	claims := &SignedDetails{
+		ID:      uid,
+		Version: version,
+		Type:    magicTokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        NewTokenID(),
+			ExpiresAt: now.Add(MagicLinkTTL).Unix(),
+			IssuedAt:  now.Unix(),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signToken, err := token.SignedString([]byte(SECRET_KEY))
+	token, err := signClaims(claims)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+func ValidateMagicLinkToken(signedToken string) (*SignedDetails, string) {
+	claims, msg := parseToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if claims.Type != magicTokenType || claims.Id == "" {
+		return nil, "The sign-in link is invalid"
+	}
+
+	if msg := checkRevocation(claims); msg != "" {
+		return nil, msg
 	}
-	return signToken, nil
+
+	return claims, ""
+}
+
+// GenerateDataExportToken signs the token in a data export download link. Its
+// jti is the export's ID, and it stops working at expiresAt.
+func GenerateDataExportToken(uid string, version int, exportID string, expiresAt time.Time) (string, error) {
+	claims := &SignedDetails{
+		ID:      uid,
+		Version: version,
+		Type:    exportTokenType,
+		StandardClaims: jwt.StandardClaims{
+			Id:        exportID,
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+	return signClaims(claims)
+}
+
+func ValidateDataExportToken(signedToken string) (*SignedDetails, string) {
+	claims, msg := parseToken(signedToken)
+	if msg != "" {
+		return nil, msg
+	}
+
+	if claims.Type != exportTokenType || claims.Id == "" {
+		return nil, "The download link is invalid"
+	}
+
+	user, err := queries.GetUserByID(claims.ID)
+	if err != nil || user.TokenVersion != claims.Version {
+		return nil, "The download link is invalid"
+	}
+
+	return claims, ""
 }
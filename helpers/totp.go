@@ -0,0 +1,126 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6238 parameters. These are the defaults every authenticator app
+// understands, so they are not configurable.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is the number of periods either side of now that are accepted
+	// to allow for clock drift.
+	totpSkew = 1
+
+	backupCodeCount    = 10
+	backupCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTotpSecret returns a random 160-bit secret, base32 encoded.
+func GenerateTotpSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TotpURI builds the otpauth:// URI that authenticator apps scan.
+func TotpURI(issuer string, account string, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	// Authenticator apps expect %20 rather than + for spaces.
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+}
+
+// ValidateTotp checks code against secret and returns the time step it
+// matched. Steps at or before lastUsedStep are rejected so a code cannot be
+// replayed.
+func ValidateTotp(secret string, code string, lastUsedStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateBackupCodes returns one-time recovery codes together with the
+// hashes that should be stored in their place.
+func GenerateBackupCodes() ([]string, []string, error) {
+	codes := make([]string, 0, backupCodeCount)
+	hashes := make([]string, 0, backupCodeCount)
+
+	for i := 0; i < backupCodeCount; i++ {
+		raw := make([]byte, 10)
+		for j := range raw {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(backupCodeAlphabet))))
+			if err != nil {
+				return nil, nil, err
+			}
+			raw[j] = backupCodeAlphabet[n.Int64()]
+		}
+		code := string(raw[:5]) + "-" + string(raw[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, HashBackupCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// HashBackupCode normalises a backup code as typed by the user and hashes it.
+func HashBackupCode(code string) string {
+	normalised := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
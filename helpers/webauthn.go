@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const WebauthnSessionTTL = 5 * time.Minute
+
+var (
+	webAuthn     *webauthn.WebAuthn
+	webAuthnErr  error
+	webAuthnOnce sync.Once
+)
+
+// WebAuthn returns the relying party configured from WEBAUTHN_RP_ID,
+// WEBAUTHN_RP_NAME and the comma separated WEBAUTHN_RP_ORIGINS.
+func WebAuthn() (*webauthn.WebAuthn, error) {
+	webAuthnOnce.Do(func() {
+		name := os.Getenv("WEBAUTHN_RP_NAME")
+		if name == "" {
+			name = "udo-golang"
+		}
+
+		var origins []string
+		for _, origin := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+
+		webAuthn, webAuthnErr = webauthn.New(&webauthn.Config{
+			RPID:          os.Getenv("WEBAUTHN_RP_ID"),
+			RPDisplayName: name,
+			RPOrigins:     origins,
+			Timeouts: webauthn.TimeoutsConfig{
+				Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: WebauthnSessionTTL, TimeoutUVD: WebauthnSessionTTL},
+				Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: WebauthnSessionTTL, TimeoutUVD: WebauthnSessionTTL},
+			},
+		})
+	})
+
+	return webAuthn, webAuthnErr
+}
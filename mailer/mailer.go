@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Message is a rendered email ready to be delivered.
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+}
+
+// Mailer delivers rendered messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var Default Mailer
+
+// IsProduction reports whether the app runs in production mode. In production
+// emails may only be delivered through SMTP, so codes never reach the logs.
+func IsProduction() bool {
+	return strings.EqualFold(os.Getenv("APP_ENV"), "production")
+}
+
+// Init configures Default from the environment. MAIL_DRIVER selects "smtp",
+// "file" or "stdout"; the latter two are development sinks.
+func Init() error {
+	driver := strings.ToLower(os.Getenv("MAIL_DRIVER"))
+	if driver == "" {
+		driver = "stdout"
+		if IsProduction() {
+			driver = "smtp"
+		}
+	}
+
+	if IsProduction() && driver != "smtp" {
+		return fmt.Errorf("mail driver %q is not allowed in production", driver)
+	}
+
+	switch driver {
+	case "smtp":
+		m, err := NewSMTPMailer()
+		if err != nil {
+			return err
+		}
+		Default = m
+	case "file":
+		path := os.Getenv("MAIL_FILE_PATH")
+		if path == "" {
+			path = "mail.log"
+		}
+		Default = NewFileMailer(path)
+	case "stdout":
+		Default = NewStdoutMailer()
+	default:
+		return fmt.Errorf("unknown mail driver %q", driver)
+	}
+
+	return nil
+}
+
+// SendTemplate renders the named template with data and sends it to the
+// given address through Default.
+func SendTemplate(to string, name string, data interface{}) error {
+	if Default == nil {
+		return fmt.Errorf("mailer is not configured")
+	}
+
+	tmpl, ok := templates[name]
+	if !ok {
+		return fmt.Errorf("unknown email template %q", name)
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+
+	return Default.Send(Message{
+		To:      to,
+		Subject: tmpl.subject,
+		HTML:    body.String(),
+	})
+}
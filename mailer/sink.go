@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// writerMailer writes every message to a local sink instead of delivering it.
+// It is meant for development only; Init refuses it in production.
+type writerMailer struct {
+	mu   sync.Mutex
+	open func() (io.WriteCloser, error)
+}
+
+// NewFileMailer appends every message to the file at path.
+func NewFileMailer(path string) Mailer {
+	return &writerMailer{open: func() (io.WriteCloser, error) {
+		return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	}}
+}
+
+// NewStdoutMailer prints every message to stdout.
+func NewStdoutMailer() Mailer {
+	return &writerMailer{open: func() (io.WriteCloser, error) {
+		return nopCloser{os.Stdout}, nil
+	}}
+}
+
+func (m *writerMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, err := m.open()
+	if err != nil {
+		return fmt.Errorf("failed to open mail sink: %w", err)
+	}
+	defer w.Close()
+
+	_, err = w.Write(buildMessage("dev@localhost", msg))
+	if err == nil {
+		_, err = io.WriteString(w, "\r\n\r\n")
+	}
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
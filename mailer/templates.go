@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"embed"
+	"html/template"
+)
+
+const (
+	TemplateVerification = "verification"
+	TemplateReset        = "reset"
+	TemplateWelcome      = "welcome"
+	TemplateMagicLink    = "magicLink"
+	TemplateNewDevice    = "newDevice"
+	TemplateEmailChange  = "emailChange"
+	TemplateEmailNotice  = "emailChangeNotice"
+	TemplateDeletion     = "accountDeletion"
+	TemplateDeletionCode = "deletionCode"
+	TemplateDataExport   = "dataExport"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+type emailTemplate struct {
+	subject string
+	body    *template.Template
+}
+
+var templates = map[string]emailTemplate{
+	TemplateVerification: parse("Verify your account", "verification.html"),
+	TemplateReset:        parse("Reset your password", "reset.html"),
+	TemplateWelcome:      parse("Welcome aboard", "welcome.html"),
+	TemplateMagicLink:    parse("Your sign-in link", "magicLink.html"),
+	TemplateNewDevice:    parse("New sign-in to your account", "newDevice.html"),
+	TemplateEmailChange:  parse("Confirm your new email address", "emailChange.html"),
+	TemplateEmailNotice:  parse("Your email address is being changed", "emailChangeNotice.html"),
+	TemplateDeletion:     parse("Your account is scheduled for deletion", "accountDeletion.html"),
+	TemplateDeletionCode: parse("Confirm your account deletion", "deletionCode.html"),
+	TemplateDataExport:   parse("Your data export is ready", "dataExport.html"),
+}
+
+func parse(subject string, file string) emailTemplate {
+	return emailTemplate{
+		subject: subject,
+		body:    template.Must(template.ParseFS(templateFiles, "templates/layout.html", "templates/"+file)),
+	}
+}
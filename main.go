@@ -1,10 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"udo-golang/helpers"
+	"udo-golang/mailer"
 	"udo-golang/middleware"
+	"udo-golang/oauth"
+	"udo-golang/queries"
 	"udo-golang/routes"
 
 	"github.com/gin-gonic/gin"
@@ -23,14 +29,50 @@ func main() {
 		log.Fatal("PORT is not set in the environment")
 	}
 
+	if err := helpers.InitKeySet(); err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+	helpers.StartKeyRotation()
+
+	if err := mailer.Init(); err != nil {
+		log.Fatal("Failed to configure mailer: ", err)
+	}
+
+	if err := oauth.Init(); err != nil {
+		log.Fatal("Failed to configure sign-in providers: ", err)
+	}
+
+	if err := middleware.InitRateLimitStore(); err != nil {
+		log.Fatal("Failed to configure rate limiting: ", err)
+	}
+
+	if err := queries.EnsureIndexes(); err != nil {
+		if errors.Is(err, queries.ErrRequiredIndex) {
+			log.Fatal("Failed to create indexes: ", err)
+		}
+		log.Printf("Warning: %v", err)
+	}
+	helpers.StartAccountPurge()
+	helpers.StartDataExportCleanup()
+
 	router := gin.Default()
+
+	// Client IPs feed the brute-force protection, so forwarding headers are
+	// only honoured when they come from a configured proxy.
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+
 	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.AuditImpersonation())
 
 	// Public Routes
 	routes.AuthRoutes(router)
+	routes.WellKnownRoutes(router)
 
 	// Private Routes
 	routes.UserRoutes(router)
+	routes.ServiceAccountRoutes(router)
 
 	fmt.Println("🚀 Server is running on port:", port)
 
@@ -38,3 +80,13 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
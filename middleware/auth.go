@@ -8,88 +8,133 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// credentials splits the Authorization header into an "ApiKey" personal
+// access token or an access token, which may come with or without the
+// "Bearer" prefix. Everything that reads the header must go through it so
+// that no form of a credential slips past one reader but not another.
+func credentials(c *gin.Context) (apiKey string, token string) {
+	header := c.Request.Header.Get("Authorization")
+	if key, ok := strings.CutPrefix(header, "ApiKey "); ok {
+		return strings.TrimSpace(key), ""
+	}
+	if strings.HasPrefix(header, "Bearer") {
+		return "", strings.TrimSpace(strings.TrimPrefix(header, "Bearer"))
+	}
+	return "", header
+}
+
+// authenticate validates the Authorization header, which carries either a
+// "Bearer" access token or an "ApiKey" personal access token, and stores the
+// resulting claims on the context. It aborts the request on failure.
+func authenticate(c *gin.Context) (*helpers.SignedDetails, bool) {
+	if c.Request.Header.Get("Authorization") == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  http.StatusUnauthorized,
+			"success": false,
+			"message": "No Authorization header provided",
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	var claims *helpers.SignedDetails
+	var err string
+
+	if key, token := credentials(c); key != "" {
+		claims, err = helpers.ValidateAPIKey(key)
+	} else {
+		claims, err = helpers.ValidateToken(token)
+	}
+
+	if err != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  http.StatusUnauthorized,
+			"success": false,
+			"message": err,
+		})
+		c.Abort()
+		return nil, false
+	}
+
+	c.Set("email", claims.Email)
+	c.Set("id", claims.ID)
+	c.Set("isAdmin", claims.IsAdmin)
+	c.Set("claims", claims)
+	if claims.Actor != nil {
+		c.Set("actor", claims.Actor)
+	}
+
+	return claims, true
+}
+
 func IsAuthenticated() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientToken := c.Request.Header.Get("Authorization")
-		if clientToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  http.StatusUnauthorized,
-				"success": false,
-				"message": "No Authorization header provided",
-			})
-			c.Abort()
+		if _, ok := authenticate(c); !ok {
 			return
 		}
 
-		updatedToken := clientToken
+		c.Next()
+	}
+}
 
-		if strings.HasPrefix(clientToken, "Bearer") {
-			updatedToken = strings.Split(clientToken, " ")[1]
+func IsAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authenticate(c)
+		if !ok {
+			return
 		}
 
-		claims, err := helpers.ValidateToken(updatedToken)
-		if err != "" {
+		// Service accounts are provisioned by admins and always scoped, so
+		// admin routes accept them and leave the decision to RequireScope.
+		if !claims.IsAdmin && !claims.Service {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"status":  http.StatusUnauthorized,
 				"success": false,
-				"message": err,
+				"message": "You don't have the permission to access this data",
 			})
 			c.Abort()
 			return
 		}
 
-		c.Set("email", claims.Email)
-		c.Set("id", claims.ID)
-		c.Set("isAdmin", claims.IsAdmin)
-
 		c.Next()
 	}
 }
 
-func IsAdmin() gin.HandlerFunc {
+// RequireScope limits a route to credentials holding scope. It must run
+// after IsAuthenticated or IsAdmin; a user's own session holds every scope.
+func RequireScope(scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientToken := c.Request.Header.Get("Authorization")
-		if clientToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  http.StatusUnauthorized,
+		claims := c.MustGet("claims").(*helpers.SignedDetails)
+		if !claims.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  http.StatusForbidden,
 				"success": false,
-				"message": "No Authorization header provided",
+				"message": "This credential is missing the " + scope + " scope",
 			})
 			c.Abort()
 			return
 		}
 
-		updatedToken := clientToken
-
-		if strings.HasPrefix(clientToken, "Bearer") {
-			updatedToken = strings.Split(clientToken, " ")[1]
-		}
-
-		claims, err := helpers.ValidateToken(updatedToken)
-		if err != "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  http.StatusUnauthorized,
-				"success": false,
-				"message": err,
-			})
-			c.Abort()
-			return
-		}
+		c.Next()
+	}
+}
 
-		if !claims.IsAdmin {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  http.StatusUnauthorized,
+// RequireSession limits a route to a user's own session, for account and
+// credential management that scoped credentials such as API keys must never
+// reach. It must run after IsAuthenticated.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*helpers.SignedDetails)
+		if claims.Scopes != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  http.StatusForbidden,
 				"success": false,
-				"message": "You don't have the permission to access this data",
+				"message": "This action requires signing in",
 			})
 			c.Abort()
 			return
 		}
 
-		c.Set("email", claims.Email)
-		c.Set("id", claims.ID)
-		c.Set("isAdmin", claims.IsAdmin)
-
 		c.Next()
 	}
 }
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/models"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditImpersonation writes an audit event for every request carrying an
+// impersonation token, including requests to routes that do not authenticate
+// and requests that are rejected.
+func AuditImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, token := credentials(c)
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		claims, msg := helpers.ParseAccessToken(token)
+		if msg != "" || claims.Actor == nil {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		userID, err := primitive.ObjectIDFromHex(claims.ID)
+		if err != nil {
+			return
+		}
+		actorID, err := primitive.ObjectIDFromHex(claims.Actor.Subject)
+		if err != nil {
+			return
+		}
+
+		err = queries.CreateAuditEvent(&models.AuditEvent{
+			ID:        primitive.NewObjectID(),
+			Action:    models.AuditImpersonationRequest,
+			UserID:    userID,
+			ActorID:   &actorID,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			log.Printf("Failed to record impersonated request: %v", err)
+		}
+	}
+}
+
+// ForbidImpersonation rejects requests made under impersonation, for actions
+// support staff must never take on a user's behalf. It must run after
+// IsAuthenticated or IsAdmin.
+func ForbidImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*helpers.SignedDetails)
+		if claims.Actor != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  http.StatusForbidden,
+				"success": false,
+				"message": "This action is not available while impersonating a user",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,258 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"udo-golang/helpers"
+	"udo-golang/queries"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitResult is the state of a bucket after a Take.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token is available when the
+	// request was not allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore holds token buckets. A bucket holds up to capacity tokens
+// and refills continuously at capacity tokens per period.
+type RateLimitStore interface {
+	Take(key string, capacity int, period time.Duration) (RateLimitResult, error)
+}
+
+// KeyFunc picks the bucket a request is counted against.
+type KeyFunc func(c *gin.Context) string
+
+var DefaultRateLimitStore RateLimitStore = NewMemoryRateLimitStore()
+
+// InitRateLimitStore selects the store from RATE_LIMIT_STORE: "memory" (the
+// default) for a single instance, or "mongo" to share limits across replicas.
+func InitRateLimitStore() error {
+	switch strings.ToLower(os.Getenv("RATE_LIMIT_STORE")) {
+	case "", "memory":
+		DefaultRateLimitStore = NewMemoryRateLimitStore()
+	case "mongo":
+		DefaultRateLimitStore = MongoRateLimitStore{}
+	default:
+		return fmt.Errorf("unknown rate limit store %q", os.Getenv("RATE_LIMIT_STORE"))
+	}
+	return nil
+}
+
+// RateLimiter limits requests to capacity per period for each key. The
+// limit can be overridden per name with RATE_LIMIT_<NAME>=<capacity>/<period>,
+// e.g. RATE_LIMIT_AUTH=30/1m.
+func RateLimiter(name string, capacity int, period time.Duration, key KeyFunc) gin.HandlerFunc {
+	envName := "RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if override := os.Getenv(envName); override != "" {
+		c, p, err := parseRateLimit(override)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", envName, err)
+		}
+		capacity, period = c, p
+	}
+
+	return func(c *gin.Context) {
+		result, err := DefaultRateLimitStore.Take(name+":"+key(c), capacity, period)
+		if err != nil {
+			// Fail open: an unavailable store should not take the API down.
+			log.Printf("Rate limit store error: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(capacity))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"status":  http.StatusTooManyRequests,
+				"success": false,
+				"message": "Too many requests, please try again later",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func parseRateLimit(value string) (int, time.Duration, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected <capacity>/<period>, got %q", value)
+	}
+
+	capacity, err := strconv.Atoi(parts[0])
+	if err != nil || capacity < 1 {
+		return 0, 0, fmt.Errorf("invalid capacity %q", parts[0])
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("invalid period %q", parts[1])
+	}
+
+	return capacity, period, nil
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// KeyByIP counts requests per client IP.
+func KeyByIP() KeyFunc {
+	return func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// KeyByUser counts requests per authenticated user, falling back to the
+// client IP for anonymous requests. It may run before IsAuthenticated, so it
+// reads the bearer token itself; the token is only used as a key here and
+// authentication is still left to IsAuthenticated.
+func KeyByUser() KeyFunc {
+	return func(c *gin.Context) string {
+		if id := c.GetString("id"); id != "" {
+			return "user:" + id
+		}
+
+		key, token := credentials(c)
+		if key != "" {
+			return "apikey:" + helpers.HashAPIKey(key)
+		}
+		if token != "" {
+			if claims, msg := helpers.ParseAccessToken(token); msg == "" {
+				return "user:" + claims.ID
+			}
+		}
+
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// KeyByField counts requests per value of a top-level JSON body field, such
+// as an email address, falling back to the client IP when it is missing. The
+// body is restored so the handler can still bind it.
+func KeyByField(field string) KeyFunc {
+	return func(c *gin.Context) string {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		if err != nil {
+			return "ip:" + c.ClientIP()
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err == nil {
+			if value, ok := payload[field].(string); ok && value != "" {
+				return field + ":" + strings.ToLower(strings.TrimSpace(value))
+			}
+		}
+
+		return "ip:" + c.ClientIP()
+	}
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	period    time.Duration
+}
+
+// MemoryRateLimitStore keeps buckets in process memory. Limits are per
+// instance, so it is only suitable when running a single replica.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, capacity int, period time.Duration) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(capacity), updatedAt: now, period: period}
+		s.buckets[key] = b
+	}
+
+	rate := float64(capacity) / period.Seconds()
+	b.tokens = math.Min(float64(capacity), b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+	b.updatedAt = now
+	b.period = period
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return bucketResult(allowed, b.tokens, capacity, rate), nil
+}
+
+// sweep drops buckets idle long enough to have refilled completely, which
+// are indistinguishable from missing ones.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.Sub(b.updatedAt) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// MongoRateLimitStore keeps buckets in MongoDB so every replica shares them.
+type MongoRateLimitStore struct{}
+
+func (MongoRateLimitStore) Take(key string, capacity int, period time.Duration) (RateLimitResult, error) {
+	rate := float64(capacity) / period.Seconds()
+
+	tokens, allowed, err := queries.TakeRateLimitToken(key, capacity, rate, period)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	return bucketResult(allowed, tokens, capacity, rate), nil
+}
+
+func bucketResult(allowed bool, tokens float64, capacity int, rate float64) RateLimitResult {
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(capacity) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditDataExport           = "data-export.request"
+)
+
+// AuditEvent records a sensitive action on a user's account. ActorID is set
+// when someone other than the user, such as an impersonating admin, acted.
+type AuditEvent struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Action    string              `bson:"action" json:"action"`
+	UserID    primitive.ObjectID  `bson:"userId" json:"userId"`
+	ActorID   *primitive.ObjectID `bson:"actorId,omitempty" json:"actorId,omitempty"`
+	Reason    string              `bson:"reason,omitempty" json:"reason,omitempty"`
+	Method    string              `bson:"method,omitempty" json:"method,omitempty"`
+	Path      string              `bson:"path,omitempty" json:"path,omitempty"`
+	Status    int                 `bson:"status,omitempty" json:"status,omitempty"`
+	IP        string              `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string              `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`
+}
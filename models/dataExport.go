@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is an archive of everything stored about a user, built in the
+// background on request. RequestedBy differs from UserID when an admin asked
+// on the user's behalf. The record expires at ExpiresAt; the archive itself
+// is stored separately and removed once the record has expired.
+type DataExport struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	RequestedBy primitive.ObjectID `bson:"requestedBy" json:"requestedBy"`
+	Status      string             `bson:"status" json:"status"`
+	Size        int                `bson:"size,omitempty" json:"size,omitempty"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CompletedAt *time.Time         `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+
+	// TokenHash is the hash of the random token in the emailed download
+	// link, which stops working once the user's token version moves past
+	// TokenVersion, e.g. on logout from every device.
+	TokenHash    string `bson:"tokenHash,omitempty" json:"-"`
+	TokenVersion int    `bson:"tokenVersion" json:"-"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Identity links a user to an account at an external sign-in provider. The
+// provider's subject, not the email address, identifies the account, since
+// providers can reassign addresses.
+type Identity struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID   primitive.ObjectID `bson:"userId" json:"userId"`
+	Provider string             `bson:"provider" json:"provider"`
+	Subject  string             `bson:"subject" json:"subject"`
+	Email    string             `bson:"email,omitempty" json:"email"`
+	LinkedAt time.Time          `bson:"linkedAt" json:"linkedAt"`
+}
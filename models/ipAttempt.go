@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IPAttempt counts failed authentication attempts from one IP address. The
+// document expires once the IP has been quiet for the counting window.
+type IPAttempt struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	IP           string             `bson:"ip" json:"ip"`
+	Failures     int                `bson:"failures" json:"failures"`
+	LastFailedAt *time.Time         `bson:"lastFailedAt,omitempty" json:"lastFailedAt"`
+	LockedUntil  *time.Time         `bson:"lockedUntil,omitempty" json:"lockedUntil"`
+	ExpiresAt    time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginEvent records a successful sign-in. Sign-ins from a new IP and user
+// agent pair are mailed to the user with a link, identified by
+// ReportTokenHash, to report that it was not them.
+type LoginEvent struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID          primitive.ObjectID `bson:"userId" json:"userId"`
+	SessionID       primitive.ObjectID `bson:"sessionId" json:"sessionId"`
+	IP              string             `bson:"ip" json:"ip"`
+	UserAgent       string             `bson:"userAgent" json:"userAgent"`
+	DeviceName      string             `bson:"deviceName" json:"deviceName"`
+	NewDevice       bool               `bson:"newDevice" json:"newDevice"`
+	ReportTokenHash string             `bson:"reportTokenHash,omitempty" json:"-"`
+	ReportExpiresAt *time.Time         `bson:"reportExpiresAt,omitempty" json:"-"`
+	ReportedAt      *time.Time         `bson:"reportedAt,omitempty" json:"reportedAt,omitempty"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MagicLink is a single-use email sign-in link. NonceHash binds it to the
+// browser that requested it.
+type MagicLink struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TokenID   string             `bson:"tokenId" json:"-"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	NonceHash string             `bson:"nonceHash" json:"-"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty" json:"usedAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OAuthState tracks one external sign-in attempt between the redirect to the
+// provider and its callback. It is deleted when the callback consumes it.
+type OAuthState struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	State        string             `bson:"state" json:"-"`
+	Provider     string             `bson:"provider" json:"provider"`
+	CodeVerifier string             `bson:"codeVerifier" json:"-"`
+	Nonce        string             `bson:"nonce" json:"-"`
+	// LinkUserID is set when a signed-in user is linking the provider to
+	// their account rather than signing in with it.
+	LinkUserID *primitive.ObjectID `bson:"linkUserId,omitempty" json:"-"`
+	ExpiresAt  time.Time           `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+}
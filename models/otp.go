@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OTP purposes. A code issued for one purpose is never accepted for another.
+const (
+	OtpPurposeVerify      = "verify"
+	OtpPurposeReset       = "reset"
+	OtpPurposeLogin       = "login"
+	OtpPurposeEmailChange = "email-change"
+	OtpPurposeDeletion    = "account-deletion"
+)
+
+// Otp is a one-time code mailed to a user. Only its hash is stored, and at
+// most one code per user and purpose is live at a time.
+type Otp struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Purpose   string             `bson:"purpose" json:"purpose"`
+	CodeHash  string             `bson:"codeHash" json:"-"`
+	Attempts  int                `bson:"attempts" json:"attempts"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	// Target is the address the code was mailed to when the code confirms
+	// that address, such as a new email; it is only accepted for that one.
+	Target string `bson:"target,omitempty" json:"-"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken tracks a single issued refresh token. Tokens rotated from the
+// same login share a Family so the whole chain can be revoked on reuse.
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TokenID   string             `bson:"tokenId" json:"-"`
+	Family    string             `bson:"family" json:"family"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty" json:"usedAt"`
+	RevokedAt *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
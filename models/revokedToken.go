@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RevokedToken is a denylisted access token. Entries are kept until the token
+// would have expired anyway.
+type RevokedToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TokenID   string             `bson:"tokenId" json:"tokenId"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ServiceAccount is a machine client that signs in with the OAuth2 client
+// credentials grant. Only a hash of its secret is stored.
+type ServiceAccount struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name         string             `bson:"name" json:"name"`
+	ClientID     string             `bson:"clientId" json:"clientId"`
+	SecretHash   string             `bson:"secretHash" json:"-"`
+	Scopes       []string           `bson:"scopes" json:"scopes"`
+	TokenVersion int                `bson:"tokenVersion" json:"-"`
+	CreatedBy    primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	LastUsedAt   *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
@@ -10,18 +10,30 @@ import (
 )
 
 type User struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	FirstName  string             `bson:"firstName" json:"firstName" validate:"required"`
-	LastName   string             `bson:"lastName" json:"lastName" validate:"required"`
-	Email      string             `bson:"email" json:"email" validate:"required,email"`
-	Password   string             `bson:"password,omitempty" json:"-" validate:"required,min=6"`
-	IsAdmin    bool               `bson:"isAdmin" json:"isAdmin"`
-	IsVerified bool               `bson:"isVerified" json:"isVerified"`
-	LastLogin  *time.Time         `bson:"lastLogin,omitempty" json:"lastLogin"`
-	Otp        *string            `bson:"otp,omitempty" json:"otp"`
-	OtpExpire  *time.Time         `bson:"otpExpire,omitempty" json:"otpExpire"`
-	CreatedAt  time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt  *time.Time         `bson:"updatedAt,omitempty" json:"updatedAt"`
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	FirstName           string             `bson:"firstName" json:"firstName" validate:"required"`
+	LastName            string             `bson:"lastName" json:"lastName" validate:"required"`
+	Email               string             `bson:"email" json:"email" validate:"required,email"`
+	PendingEmail        string             `bson:"pendingEmail,omitempty" json:"pendingEmail,omitempty"`
+	Password            string             `bson:"password,omitempty" json:"-" validate:"required,min=6"`
+	PasswordHistory     []string           `bson:"passwordHistory,omitempty" json:"-"`
+	IsAdmin             bool               `bson:"isAdmin" json:"isAdmin"`
+	IsVerified          bool               `bson:"isVerified" json:"isVerified"`
+	LastLogin           *time.Time         `bson:"lastLogin,omitempty" json:"lastLogin"`
+	TokenVersion        int                `bson:"tokenVersion" json:"-"`
+	MfaEnabled          bool               `bson:"mfaEnabled" json:"mfaEnabled"`
+	MfaSecret           *string            `bson:"mfaSecret,omitempty" json:"-"`
+	MfaPendingSecret    *string            `bson:"mfaPendingSecret,omitempty" json:"-"`
+	MfaLastUsedStep     int64              `bson:"mfaLastUsedStep,omitempty" json:"-"`
+	MfaBackupCodes      []string           `bson:"mfaBackupCodes,omitempty" json:"-"`
+	FailedLoginAttempts int                `bson:"failedLoginAttempts,omitempty" json:"failedLoginAttempts"`
+	LastFailedLoginAt   *time.Time         `bson:"lastFailedLoginAt,omitempty" json:"lastFailedLoginAt"`
+	LockedUntil         *time.Time         `bson:"lockedUntil,omitempty" json:"lockedUntil"`
+	DeletionRequestedAt *time.Time         `bson:"deletionRequestedAt,omitempty" json:"deletionRequestedAt,omitempty"`
+	DeletionScheduledAt *time.Time         `bson:"deletionScheduledAt,omitempty" json:"deletionScheduledAt,omitempty"`
+	DeletedAt           *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	CreatedAt           time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt           *time.Time         `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
 
 var validate = validator.New()
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebauthnCredential is a passkey registered by a user.
+type WebauthnCredential struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID       primitive.ObjectID  `bson:"userId" json:"userId"`
+	CredentialID []byte              `bson:"credentialId" json:"-"`
+	Name         string              `bson:"name" json:"name"`
+	Credential   webauthn.Credential `bson:"credential" json:"-"`
+	CreatedAt    time.Time           `bson:"createdAt" json:"createdAt"`
+	LastUsedAt   *time.Time          `bson:"lastUsedAt,omitempty" json:"lastUsedAt"`
+}
+
+// WebauthnSession holds the server side state of an in-flight registration or
+// login ceremony.
+type WebauthnSession struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	SessionID string               `bson:"sessionId" json:"sessionId"`
+	Ceremony  string               `bson:"ceremony" json:"ceremony"`
+	UserID    *primitive.ObjectID  `bson:"userId,omitempty" json:"userId"`
+	Data      webauthn.SessionData `bson:"data" json:"-"`
+	ExpiresAt time.Time            `bson:"expiresAt" json:"expiresAt"`
+}
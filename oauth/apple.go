@@ -0,0 +1,100 @@
+package oauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// Sign in with Apple is OIDC, but its client secret is a short-lived JWT
+// signed with a key from the developer account. It is configured with
+// OAUTH_APPLE_TEAM_ID, OAUTH_APPLE_KEY_ID and OAUTH_APPLE_PRIVATE_KEY_FILE.
+func configureApple(p *Provider) error {
+	teamID := env(p.Name, "TEAM_ID")
+	keyID := env(p.Name, "KEY_ID")
+	keyFile := env(p.Name, "PRIVATE_KEY_FILE")
+	if teamID == "" || keyID == "" || keyFile == "" {
+		return errors.New("OAUTH_APPLE_TEAM_ID, OAUTH_APPLE_KEY_ID and OAUTH_APPLE_PRIVATE_KEY_FILE must be set")
+	}
+
+	key, err := loadApplePrivateKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	p.oidc = newOIDCProvider(issuerOr(p.Name, "https://appleid.apple.com"))
+	p.Config.Scopes = []string{"openid", "email", "name"}
+	p.Config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+
+	// Apple only returns the requested scopes when the callback is a form post.
+	p.FormPost = true
+	p.authParams = []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("response_mode", "form_post")}
+
+	p.fromCallback = appleCallbackName
+
+	p.clientSecret = func() (string, error) {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+			Issuer:    teamID,
+			Subject:   p.Config.ClientID,
+			Audience:  "https://appleid.apple.com",
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(5 * time.Minute).Unix(),
+		})
+		token.Header["kid"] = keyID
+		return token.SignedString(key)
+	}
+
+	return nil
+}
+
+// appleCallbackName fills in the user's name from the "user" form field.
+// Apple never puts the name in the ID token and only sends this field the
+// first time the user authorizes the app.
+func appleCallbackName(form url.Values, profile *Profile) {
+	var user struct {
+		Name struct {
+			FirstName string `json:"firstName"`
+			LastName  string `json:"lastName"`
+		} `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("user")), &user); err != nil {
+		return
+	}
+	if user.Name.FirstName != "" {
+		profile.FirstName = user.Name.FirstName
+		profile.LastName = user.Name.LastName
+	}
+}
+
+func loadApplePrivateKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Apple private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid Apple private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Apple private key: %w", err)
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the Apple private key must be an EC key")
+	}
+	return key, nil
+}
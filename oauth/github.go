@@ -0,0 +1,73 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// GitHub is plain OAuth 2.0, so the account is read from its REST API
+// rather than from an ID token.
+func configureGitHub(p *Provider) {
+	p.Config.Endpoint = github.Endpoint
+	p.Config.Scopes = []string{"read:user", "user:email"}
+	p.profile = githubProfile
+}
+
+func githubProfile(ctx context.Context, token *oauth2.Token) (*Profile, error) {
+	client := oauth2.NewClient(ctx, oauth2.StaticTokenSource(token))
+
+	var user struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := githubGet(client, "https://api.github.com/user", &user); err != nil {
+		return nil, err
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := githubGet(client, "https://api.github.com/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{Subject: strconv.FormatInt(user.ID, 10)}
+	profile.FirstName, profile.LastName = splitName(user.Name)
+
+	for _, email := range emails {
+		if email.Primary {
+			profile.Email = email.Email
+			profile.EmailVerified = email.Verified
+		}
+	}
+
+	return profile, nil
+}
+
+func githubGet(client *http.Client, url string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query GitHub: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to query GitHub: unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
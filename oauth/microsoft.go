@@ -0,0 +1,12 @@
+package oauth
+
+// Microsoft's identity platform is OIDC. OAUTH_MICROSOFT_TENANT selects the
+// tenant and defaults to "common", which accepts work and personal accounts.
+func configureMicrosoft(p *Provider) error {
+	tenant := env(p.Name, "TENANT")
+	if tenant == "" {
+		tenant = "common"
+	}
+	p.oidc = newOIDCProvider(issuerOr(p.Name, "https://login.microsoftonline.com/"+tenant+"/v2.0"))
+	return nil
+}
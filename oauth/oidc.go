@@ -0,0 +1,227 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"udo-golang/helpers"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// oidcProvider verifies ID tokens from an OpenID Connect issuer. Its
+// endpoints and keys come from the issuer's discovery document, fetched on
+// first use.
+type oidcProvider struct {
+	issuer string
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      helpers.KeySource
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	Email         string               `json:"email"`
+	EmailVerified helpers.FlexibleBool `json:"email_verified"`
+	Name          string               `json:"name"`
+	GivenName     string               `json:"given_name"`
+	FamilyName    string               `json:"family_name"`
+	Nonce         string               `json:"nonce"`
+	TenantID      string               `json:"tid"`
+	// Microsoft only asserts ownership of the email through this optional
+	// claim; without it the address must be treated as unverified.
+	DomainOwnerVerified helpers.FlexibleBool `json:"xms_edov"`
+	// Audience shadows StandardClaims.Audience, which only decodes the
+	// single string form of aud.
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	jwt.StandardClaims
+}
+
+// audience is the aud claim, which may be a single string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings: %w", err)
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func newOIDCProvider(issuer string) *oidcProvider {
+	return &oidcProvider{issuer: strings.TrimRight(issuer, "/")}
+}
+
+func (o *oidcProvider) discover(ctx context.Context) (*oidcDiscovery, helpers.KeySource, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.discovery != nil {
+		return o.discovery, o.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch OIDC discovery document: unexpected status %d", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode OIDC discovery document: %w", err)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, nil, errors.New("incomplete OIDC discovery document")
+	}
+	// The document must describe the issuer it was fetched for (OIDC
+	// Discovery §4.3), or another issuer's tokens would be accepted.
+	if !issuerMatches(discovery.Issuer, o.issuer) {
+		return nil, nil, fmt.Errorf("OIDC discovery document is for issuer %q, expected %q", discovery.Issuer, o.issuer)
+	}
+
+	o.discovery = &discovery
+	o.keys = helpers.NewRemoteKeySource(discovery.JwksURI)
+	return o.discovery, o.keys, nil
+}
+
+// issuerMatches compares a discovery document's issuer with the configured
+// one. A templated "{tenantid}" segment, as Microsoft's multi-tenant
+// endpoints publish, matches any single path segment such as "common".
+func issuerMatches(published, configured string) bool {
+	published = strings.TrimRight(published, "/")
+	prefix, suffix, templated := strings.Cut(published, "{tenantid}")
+	if !templated {
+		return published == configured
+	}
+	if !strings.HasPrefix(configured, prefix) || !strings.HasSuffix(configured, suffix) || len(configured) < len(prefix)+len(suffix) {
+		return false
+	}
+	tenant := configured[len(prefix) : len(configured)-len(suffix)]
+	return tenant != "" && !strings.Contains(tenant, "/")
+}
+
+func (o *oidcProvider) endpoint(ctx context.Context) (oauth2.Endpoint, error) {
+	discovery, _, err := o.discover(ctx)
+	if err != nil {
+		return oauth2.Endpoint{}, err
+	}
+	return oauth2.Endpoint{AuthURL: discovery.AuthorizationEndpoint, TokenURL: discovery.TokenEndpoint}, nil
+}
+
+// profile verifies the ID token returned alongside token and reads the
+// account from it.
+func (o *oidcProvider) profile(token *oauth2.Token, clientID, nonce string) (*Profile, error) {
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+
+	discovery, keys, err := o.discover(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+		}
+		kid, _ := t.Header["kid"].(string)
+		return keys.Key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	// Multi-tenant issuers such as Microsoft's "common" endpoint publish a
+	// templated issuer that the token's tenant ID fills in.
+	issuer := strings.ReplaceAll(discovery.Issuer, "{tenantid}", claims.TenantID)
+	if claims.Issuer != issuer {
+		return nil, errors.New("invalid ID token: unexpected issuer")
+	}
+	if !claims.Audience.contains(clientID) {
+		return nil, errors.New("invalid ID token: issued to another client")
+	}
+	// With several audiences the token must also name us as the party it
+	// was issued to, and a present azp must always be us (OIDC Core
+	// §3.1.3.7).
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != clientID {
+		return nil, errors.New("invalid ID token: issued to another client")
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, errors.New("invalid ID token: missing expiry")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+
+	profile := &Profile{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+	}
+	if claims.TenantID != "" {
+		profile.EmailVerified = bool(claims.DomainOwnerVerified)
+	}
+	if profile.FirstName == "" {
+		profile.FirstName, profile.LastName = splitName(claims.Name)
+	}
+
+	return profile, nil
+}
+
+func splitName(name string) (string, string) {
+	parts := strings.Fields(name)
+	first, last := "", ""
+	if len(parts) > 0 {
+		first = parts[0]
+	}
+	if len(parts) > 1 {
+		last = parts[len(parts)-1]
+	}
+	return first, last
+}
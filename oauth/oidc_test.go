@@ -0,0 +1,281 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testClientID = "client-123"
+	testNonce    = "nonce-abc"
+	testKid      = "key-1"
+)
+
+// testIssuer serves a discovery document and JWKS for a single RSA key.
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// discoveryIssuer overrides the issuer published in the discovery
+	// document.
+	discoveryIssuer string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		published := issuer.URL()
+		if issuer.discoveryIssuer != "" {
+			published = issuer.discoveryIssuer
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 published,
+			"authorization_endpoint": issuer.URL() + "/authorize",
+			"token_endpoint":         issuer.URL() + "/token",
+			"jwks_uri":               issuer.URL() + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": testKid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) URL() string {
+	return i.server.URL
+}
+
+// claims returns a valid set of ID token claims for the test client.
+func (i *testIssuer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            i.URL(),
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"email":          "ada@example.test",
+		"email_verified": true,
+		"name":           "Ada Lovelace",
+		"nonce":          testNonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func (i *testIssuer) sign(t *testing.T, kid string, claims jwt.MapClaims) *oauth2.Token {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": raw})
+}
+
+func TestOIDCProfile(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	profile, err := newOIDCProvider(issuer.URL()).profile(issuer.sign(t, testKid, issuer.claims()), testClientID, testNonce)
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	if profile.Subject != "subject-1" || profile.Email != "ada@example.test" || !profile.EmailVerified {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+	if profile.FirstName != "Ada" || profile.LastName != "Lovelace" {
+		t.Errorf("name = %q %q, want Ada Lovelace", profile.FirstName, profile.LastName)
+	}
+}
+
+func TestOIDCProfileAcceptsAudienceArray(t *testing.T) {
+	tests := map[string]jwt.MapClaims{
+		"single audience":   {"aud": []string{testClientID}},
+		"with azp":          {"aud": []string{testClientID, "another-client"}, "azp": testClientID},
+		"single azp string": {"aud": testClientID, "azp": testClientID},
+	}
+
+	for name, overrides := range tests {
+		t.Run(name, func(t *testing.T) {
+			issuer := newTestIssuer(t)
+			claims := issuer.claims()
+			for key, value := range overrides {
+				claims[key] = value
+			}
+
+			if _, err := newOIDCProvider(issuer.URL()).profile(issuer.sign(t, testKid, claims), testClientID, testNonce); err != nil {
+				t.Fatalf("profile: %v", err)
+			}
+		})
+	}
+}
+
+func TestOIDCProfileRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		kid    string
+		modify func(claims jwt.MapClaims)
+		nonce  string
+		want   string
+	}{
+		{
+			name:   "bad issuer",
+			modify: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.test" },
+			want:   "unexpected issuer",
+		},
+		{
+			name:   "bad audience",
+			modify: func(claims jwt.MapClaims) { claims["aud"] = "another-client" },
+			want:   "issued to another client",
+		},
+		{
+			name:   "audience array without us",
+			modify: func(claims jwt.MapClaims) { claims["aud"] = []string{"another-client", "third-client"} },
+			want:   "issued to another client",
+		},
+		{
+			name: "audience array without azp",
+			modify: func(claims jwt.MapClaims) {
+				claims["aud"] = []string{testClientID, "another-client"}
+			},
+			want: "issued to another client",
+		},
+		{
+			name: "audience array with another azp",
+			modify: func(claims jwt.MapClaims) {
+				claims["aud"] = []string{testClientID, "another-client"}
+				claims["azp"] = "another-client"
+			},
+			want: "issued to another client",
+		},
+		{
+			name:   "expired",
+			modify: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+			want:   "expired",
+		},
+		{
+			name:   "missing expiry",
+			modify: func(claims jwt.MapClaims) { delete(claims, "exp") },
+			want:   "missing expiry",
+		},
+		{
+			name:  "nonce mismatch",
+			nonce: "another-nonce",
+			want:  "nonce mismatch",
+		},
+		{
+			name:   "missing nonce",
+			modify: func(claims jwt.MapClaims) { delete(claims, "nonce") },
+			want:   "nonce mismatch",
+		},
+		{
+			name:   "missing subject",
+			modify: func(claims jwt.MapClaims) { delete(claims, "sub") },
+			want:   "missing subject",
+		},
+		{
+			name: "unknown kid",
+			kid:  "key-2",
+			want: "unknown key ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newTestIssuer(t)
+
+			claims := issuer.claims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			kid := testKid
+			if tt.kid != "" {
+				kid = tt.kid
+			}
+			nonce := testNonce
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			_, err := newOIDCProvider(issuer.URL()).profile(issuer.sign(t, kid, claims), testClientID, nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCProfileRejectsUnsignedIDToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	raw, err := jwt.NewWithClaims(jwt.SigningMethodNone, issuer.claims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": raw})
+
+	if _, err := newOIDCProvider(issuer.URL()).profile(token, testClientID, testNonce); err == nil {
+		t.Fatal("accepted an unsigned ID token")
+	}
+}
+
+func TestOIDCDiscoveryRejectsMismatchedIssuer(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.discoveryIssuer = "https://evil.example.test"
+
+	claims := issuer.claims()
+	claims["iss"] = issuer.discoveryIssuer
+
+	_, err := newOIDCProvider(issuer.URL()).profile(issuer.sign(t, testKid, claims), testClientID, testNonce)
+	if err == nil || !strings.Contains(err.Error(), "OIDC discovery document is for issuer") {
+		t.Fatalf("err = %v, want a discovery issuer mismatch", err)
+	}
+}
+
+func TestIssuerMatches(t *testing.T) {
+	tests := []struct {
+		published, configured string
+		want                  bool
+	}{
+		{"https://accounts.google.com", "https://accounts.google.com", true},
+		{"https://accounts.google.com/", "https://accounts.google.com", true},
+		{"https://evil.example.test", "https://accounts.google.com", false},
+		{"https://login.microsoftonline.com/{tenantid}/v2.0", "https://login.microsoftonline.com/common/v2.0", true},
+		{"https://login.microsoftonline.com/{tenantid}/v2.0", "https://login.microsoftonline.com/v2.0", false},
+		{"https://login.microsoftonline.com/{tenantid}/v2.0", "https://login.microsoftonline.com/a/b/v2.0", false},
+		{"https://login.microsoftonline.com/{tenantid}/v2.0", "https://evil.example.test/common/v2.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := issuerMatches(tt.published, tt.configured); got != tt.want {
+			t.Errorf("issuerMatches(%q, %q) = %v, want %v", tt.published, tt.configured, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package oauth holds the registry of external sign-in providers. Each
+// provider runs the authorization code flow with PKCE and normalises the
+// account it returns into a Profile.
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Profile is the provider-independent view of an external account.
+type Profile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// Provider is one configured sign-in provider.
+type Provider struct {
+	Name   string
+	Config oauth2.Config
+
+	// FormPost makes the provider send the callback as a cross-site POST,
+	// which the state cookie has to allow.
+	FormPost bool
+
+	authParams   []oauth2.AuthCodeOption
+	clientSecret func() (string, error)
+	oidc         *oidcProvider
+	profile      func(ctx context.Context, token *oauth2.Token) (*Profile, error)
+	fromCallback func(form url.Values, profile *Profile)
+}
+
+var registry = map[string]*Provider{}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Init builds the registry from OAUTH_PROVIDERS, a comma separated list of
+// provider names. Each name is configured with OAUTH_<NAME>_CLIENT_ID,
+// OAUTH_<NAME>_CLIENT_SECRET and optionally OAUTH_<NAME>_SCOPES and
+// OAUTH_<NAME>_REDIRECT_URL. google, github, microsoft and apple are built
+// in; any other name is a generic OIDC provider and needs OAUTH_<NAME>_ISSUER.
+func Init() error {
+	providers := map[string]*Provider{}
+
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		provider, err := newProvider(name)
+		if err != nil {
+			return fmt.Errorf("oauth provider %s: %w", name, err)
+		}
+		providers[name] = provider
+	}
+
+	registry = providers
+	return nil
+}
+
+// Get returns the configured provider with the given name.
+func Get(name string) (*Provider, bool) {
+	provider, ok := registry[name]
+	return provider, ok
+}
+
+func env(name, key string) string {
+	return os.Getenv("OAUTH_" + strings.ToUpper(name) + "_" + key)
+}
+
+func newProvider(name string) (*Provider, error) {
+	clientID := env(name, "CLIENT_ID")
+	if clientID == "" {
+		return nil, fmt.Errorf("OAUTH_%s_CLIENT_ID is not set", strings.ToUpper(name))
+	}
+
+	redirectURL := env(name, "REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = strings.TrimRight(os.Getenv("APP_URL"), "/") + "/auth/" + url.PathEscape(name) + "/callback"
+	}
+
+	p := &Provider{
+		Name: name,
+		Config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: env(name, "CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+		},
+	}
+
+	var err error
+	switch name {
+	case "github":
+		configureGitHub(p)
+	case "google":
+		p.oidc = newOIDCProvider(issuerOr(name, "https://accounts.google.com"))
+	case "microsoft":
+		err = configureMicrosoft(p)
+	case "apple":
+		err = configureApple(p)
+	default:
+		issuer := env(name, "ISSUER")
+		if issuer == "" {
+			return nil, fmt.Errorf("OAUTH_%s_ISSUER is not set", strings.ToUpper(name))
+		}
+		p.oidc = newOIDCProvider(issuer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.oidc != nil && len(p.Config.Scopes) == 0 {
+		p.Config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if scopes := env(name, "SCOPES"); scopes != "" {
+		p.Config.Scopes = strings.FieldsFunc(scopes, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	return p, nil
+}
+
+func issuerOr(name, fallback string) string {
+	if issuer := env(name, "ISSUER"); issuer != "" {
+		return issuer
+	}
+	return fallback
+}
+
+// AuthCodeURL is where the user is sent to sign in. verifier is the PKCE
+// code verifier and nonce binds the returned ID token to this attempt.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, verifier, nonce string) (string, error) {
+	config, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	opts := append([]oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}, p.authParams...)
+	if p.oidc != nil {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", nonce))
+	}
+
+	return config.AuthCodeURL(state, opts...), nil
+}
+
+// Exchange redeems an authorization code and returns the signed-in account.
+// form is the callback's query or posted form, which some providers use to
+// pass profile data that is not in the token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string, form url.Values) (*Profile, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+
+	config, err := p.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.clientSecret != nil {
+		secret, err := p.clientSecret()
+		if err != nil {
+			return nil, err
+		}
+		config.ClientSecret = secret
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	var profile *Profile
+	if p.oidc != nil {
+		profile, err = p.oidc.profile(token, p.Config.ClientID, nonce)
+	} else {
+		profile, err = p.profile(ctx, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.fromCallback != nil {
+		p.fromCallback(form, profile)
+	}
+
+	profile.Provider = p.Name
+	profile.Email = strings.ToLower(profile.Email)
+	return profile, nil
+}
+
+// config fills in the endpoints of OIDC providers from their discovery
+// document.
+func (p *Provider) config(ctx context.Context) (oauth2.Config, error) {
+	config := p.Config
+	if p.oidc != nil {
+		endpoint, err := p.oidc.endpoint(ctx)
+		if err != nil {
+			return config, err
+		}
+		if config.Endpoint.AuthStyle != oauth2.AuthStyleAutoDetect {
+			endpoint.AuthStyle = config.Endpoint.AuthStyle
+		}
+		config.Endpoint = endpoint
+	}
+	return config, nil
+}
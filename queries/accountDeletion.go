@@ -0,0 +1,174 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDeletionCancelled is returned by PurgeUser when the account is no longer
+// due for deletion, typically because the user signed in again.
+var ErrDeletionCancelled = errors.New("account deletion was cancelled")
+
+// ScheduleAccountDeletion deactivates the account until scheduledAt, when the
+// purge job deletes it. Bumping the token version signs out every session.
+func ScheduleAccountDeletion(userId string, scheduledAt time.Time) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{"deletionRequestedAt": now, "deletionScheduledAt": scheduledAt, "updatedAt": now},
+		"$inc": bson.M{"tokenVersion": 1},
+	}
+
+	result, err := userCollection.UpdateByID(ctx, objID, update)
+	if err != nil {
+		return fmt.Errorf("failed to schedule account deletion: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with the given ID")
+	}
+	return nil
+}
+
+func CancelAccountDeletion(userId string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$unset": bson.M{"deletionRequestedAt": "", "deletionScheduledAt": ""}}
+	if _, err := userCollection.UpdateByID(ctx, objID, update); err != nil {
+		return fmt.Errorf("failed to cancel account deletion: %w", err)
+	}
+	return nil
+}
+
+// GetUsersDueForDeletion returns up to limit accounts whose grace period has
+// ended.
+func GetUsersDueForDeletion(limit int) ([]models.User, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"deletionScheduledAt": bson.M{"$lte": time.Now()}}
+	opts := options.Find().SetSort(bson.M{"deletionScheduledAt": 1}).SetLimit(int64(limit))
+
+	cursor, err := userCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users due for deletion: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode users: %w", err)
+	}
+	return users, nil
+}
+
+// PurgeUser deletes an account whose deletion is due, together with its
+// credentials, sessions and login history. With anonymize the user document
+// is kept, stripped of personal data, so records that point at it stay
+// meaningful. Audit events are kept either way.
+//
+// The user document goes last: it is what keeps the account due for purging,
+// so if deleting its dependents fails part way the next run retries them.
+func PurgeUser(userId primitive.ObjectID, anonymize bool) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"_id": userId, "deletionScheduledAt": bson.M{"$lte": now}}
+
+	due, err := userCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	if due == 0 {
+		return ErrDeletionCancelled
+	}
+
+	for _, collection := range []*mongo.Collection{
+		identityCollection,
+		webauthnCredentialCollection,
+		apiKeyCollection,
+		sessionCollection,
+		refreshTokenCollection,
+		loginEventCollection,
+		otpCollection,
+		magicLinkCollection,
+		dataExportCollection,
+	} {
+		if _, err := collection.DeleteMany(ctx, bson.M{"userId": userId}); err != nil {
+			return fmt.Errorf("failed to delete %s of user: %w", collection.Name(), err)
+		}
+	}
+
+	if _, err := deleteDataExportArchives(ctx, bson.M{"metadata.userId": userId}); err != nil {
+		return err
+	}
+
+	var matched int64
+	if anonymize {
+		update := bson.M{
+			"$set": bson.M{
+				"email":      "deleted-" + userId.Hex() + "@deleted.invalid",
+				"firstName":  "Deleted",
+				"lastName":   "User",
+				"isAdmin":    false,
+				"isVerified": false,
+				"deletedAt":  now,
+				"updatedAt":  now,
+			},
+			"$unset": bson.M{
+				"password":            "",
+				"passwordHistory":     "",
+				"pendingEmail":        "",
+				"lastLogin":           "",
+				"mfaEnabled":          "",
+				"mfaSecret":           "",
+				"mfaPendingSecret":    "",
+				"mfaLastUsedStep":     "",
+				"mfaBackupCodes":      "",
+				"failedLoginAttempts": "",
+				"lastFailedLoginAt":   "",
+				"lockedUntil":         "",
+				"deletionRequestedAt": "",
+				"deletionScheduledAt": "",
+			},
+			"$inc": bson.M{"tokenVersion": 1},
+		}
+		result, err := userCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return fmt.Errorf("failed to anonymize user: %w", err)
+		}
+		matched = result.MatchedCount
+	} else {
+		result, err := userCollection.DeleteOne(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		matched = result.DeletedCount
+	}
+
+	if matched == 0 {
+		return ErrDeletionCancelled
+	}
+
+	return nil
+}
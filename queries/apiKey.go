@@ -0,0 +1,92 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var apiKeyCollection *mongo.Collection = database.OpenCollection(database.Client, "apiKeys")
+
+func CreateAPIKey(key *models.APIKey) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := apiKeyCollection.InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("error creating api key: %w", err)
+	}
+	return nil
+}
+
+func GetAPIKeysByUser(userId primitive.ObjectID) ([]models.APIKey, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := apiKeyCollection.Find(ctx, bson.M{"userId": userId, "revokedAt": nil}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	keys := []models.APIKey{}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	var key models.APIKey
+	if err := apiKeyCollection.FindOne(ctx, bson.M{"keyHash": keyHash}).Decode(&key); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("api key not found")
+		}
+		return nil, fmt.Errorf("failed to query api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func RevokeAPIKey(userId primitive.ObjectID, id string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objID, "userId": userId, "revokedAt": nil}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+
+	result, err := apiKeyCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("api key not found")
+	}
+	return nil
+}
+
+func TouchAPIKey(id primitive.ObjectID) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := apiKeyCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"lastUsedAt": time.Now()}}); err != nil {
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ipAttemptCollection *mongo.Collection = database.OpenCollection(database.Client, "ipAttempts")
+
+// RecordFailedLogin atomically counts a failed attempt against the user and
+// returns the updated document.
+func RecordFailedLogin(userId string) (*models.User, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"failedLoginAttempts": 1},
+		"$set": bson.M{"lastFailedLoginAt": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updatedUser models.User
+	err = userCollection.FindOneAndUpdate(ctx, bson.M{"_id": objID}, update, opts).Decode(&updatedUser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record failed login: %w", err)
+	}
+
+	return &updatedUser, nil
+}
+
+func GetIPAttempt(ip string) (*models.IPAttempt, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	var attempt models.IPAttempt
+	err := ipAttemptCollection.FindOne(ctx, bson.M{"ip": ip}).Decode(&attempt)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query IP attempts: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// RecordIPFailure counts a failed attempt from ip and pushes the record's
+// expiry out by window.
+func RecordIPFailure(ip string, window time.Duration) (*models.IPAttempt, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	now := time.Now()
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"lastFailedAt": now, "expiresAt": now.Add(window)},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var attempt models.IPAttempt
+	if err := ipAttemptCollection.FindOneAndUpdate(ctx, bson.M{"ip": ip}, update, opts).Decode(&attempt); err != nil {
+		return nil, fmt.Errorf("failed to record IP failure: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// LockIP blocks ip until the given time and resets its failure count.
+func LockIP(ip string, until time.Time) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"failures": 0, "lockedUntil": until, "expiresAt": until}}
+	if _, err := ipAttemptCollection.UpdateOne(ctx, bson.M{"ip": ip}, update); err != nil {
+		return fmt.Errorf("failed to lock IP: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package queries
+
+import (
+	"fmt"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var auditEventCollection *mongo.Collection = database.OpenCollection(database.Client, "auditEvents")
+
+func CreateAuditEvent(event *models.AuditEvent) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := auditEventCollection.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("error creating audit event: %w", err)
+	}
+	return nil
+}
+
+func GetAuditEvents(page int, pageSize int, filter bson.M) ([]models.AuditEvent, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.M{"createdAt": -1}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+
+	cursor, err := auditEventCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch audit events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.AuditEvent{}
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+// GetAuditEventsByUser returns every audit event about the user or in which
+// they were the actor.
+func GetAuditEventsByUser(userId primitive.ObjectID) ([]models.AuditEvent, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{{"userId": userId}, {"actorId": userId}}}
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+
+	cursor, err := auditEventCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch audit events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.AuditEvent{}
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode audit events: %w", err)
+	}
+
+	return events, nil
+}
+
+func GetAuditEventCount(filter bson.M) (int64, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	count, err := auditEventCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,243 @@
+package queries
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var dataExportCollection *mongo.Collection = database.OpenCollection(database.Client, "dataExports")
+
+// Archives are kept in GridFS, since they can outgrow the 16 MB document
+// limit. Each file's ID is its export's ID.
+const dataExportArchiveBucket = "dataExportArchives"
+
+var dataExportArchiveFiles *mongo.Collection = database.OpenCollection(database.Client, dataExportArchiveBucket+".files")
+
+var ErrDataExportNotPending = errors.New("data export is no longer pending")
+
+// dataExportArchives opens the archive bucket. Buckets are not safe for
+// concurrent use, so every operation opens its own.
+func dataExportArchives() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(dataExportCollection.Database(), options.GridFSBucket().SetName(dataExportArchiveBucket))
+}
+
+func CreateDataExport(export *models.DataExport) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := dataExportCollection.InsertOne(ctx, export); err != nil {
+		return fmt.Errorf("error creating data export: %w", err)
+	}
+	return nil
+}
+
+// HasPendingDataExport reports whether an export of the user started after
+// startedAfter is still being built. Older pending exports have stalled and
+// no longer block a new request.
+func HasPendingDataExport(userId primitive.ObjectID, startedAfter time.Time) (bool, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"userId": userId, "status": models.DataExportPending, "createdAt": bson.M{"$gt": startedAfter}}
+	count, err := dataExportCollection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to query data exports: %w", err)
+	}
+	return count > 0, nil
+}
+
+// GetDataExport returns one of the user's exports.
+func GetDataExport(userId primitive.ObjectID, id string) (*models.DataExport, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return findDataExport(ctx, bson.M{"_id": objID, "userId": userId}, options.FindOne())
+}
+
+// GetReadyDataExport returns one of the user's exports if it is ready and
+// has not expired.
+func GetReadyDataExport(userId primitive.ObjectID, id string) (*models.DataExport, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":       objID,
+		"userId":    userId,
+		"status":    models.DataExportReady,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+	return findDataExport(ctx, filter, options.FindOne())
+}
+
+func findDataExport(ctx context.Context, filter bson.M, opts *options.FindOneOptions) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := dataExportCollection.FindOne(ctx, filter, opts).Decode(&export); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("data export not found")
+		}
+		return nil, fmt.Errorf("failed to query data export: %w", err)
+	}
+	return &export, nil
+}
+
+// GetReadyDataExportByToken returns an export if it is ready, has not
+// expired and tokenHash is the hash of its emailed link token.
+func GetReadyDataExportByToken(id string, tokenHash string) (*models.DataExport, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"_id":       objID,
+		"tokenHash": tokenHash,
+		"status":    models.DataExportReady,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+	return findDataExport(ctx, filter, options.FindOne())
+}
+
+// CompleteDataExport stores the finished archive along with the hash of the
+// token in the emailed download link. It fails with ErrDataExportNotPending,
+// and keeps nothing, if the export was given up on in the meantime.
+func CompleteDataExport(export *models.DataExport, archive []byte, tokenHash string) error {
+	bucket, err := dataExportArchives()
+	if err != nil {
+		return fmt.Errorf("failed to open data export archives: %w", err)
+	}
+	if err := bucket.SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+		return err
+	}
+
+	metadata := bson.M{"userId": export.UserID, "expiresAt": export.ExpiresAt}
+	upload := options.GridFSUpload().SetMetadata(metadata)
+	if err := bucket.UploadFromStreamWithID(export.ID, export.ID.Hex()+".zip", bytes.NewReader(archive), upload); err != nil {
+		return fmt.Errorf("failed to store data export archive: %w", err)
+	}
+
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"_id": export.ID, "status": models.DataExportPending}
+	update := bson.M{"$set": bson.M{
+		"status":      models.DataExportReady,
+		"size":        len(archive),
+		"tokenHash":   tokenHash,
+		"completedAt": time.Now(),
+	}}
+	result, err := dataExportCollection.UpdateOne(ctx, filter, update)
+	if err == nil && result.MatchedCount == 0 {
+		err = ErrDataExportNotPending
+	}
+	if err != nil {
+		if err := bucket.DeleteContext(ctx, export.ID); err != nil {
+			return fmt.Errorf("failed to remove data export archive: %w", err)
+		}
+		if errors.Is(err, ErrDataExportNotPending) {
+			return err
+		}
+		return fmt.Errorf("failed to store data export: %w", err)
+	}
+	return nil
+}
+
+// OpenDataExportArchive streams the archive of a finished export. The caller
+// closes the stream.
+func OpenDataExportArchive(id primitive.ObjectID) (*gridfs.DownloadStream, error) {
+	bucket, err := dataExportArchives()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data export archives: %w", err)
+	}
+
+	stream, err := bucket.OpenDownloadStream(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data export archive: %w", err)
+	}
+	return stream, nil
+}
+
+// FailStaleDataExports marks exports still pending after being started
+// before startedBefore as failed, since whatever was building them has
+// stopped.
+func FailStaleDataExports(startedBefore time.Time) (int64, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"status": models.DataExportPending, "createdAt": bson.M{"$lte": startedBefore}}
+	update := bson.M{"$set": bson.M{"status": models.DataExportFailed, "completedAt": time.Now()}}
+	result, err := dataExportCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail stale data exports: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// DeleteExpiredDataExportArchives removes archives whose export has expired.
+// The export records themselves are removed by their TTL index, which does
+// not reach into GridFS.
+func DeleteExpiredDataExportArchives() (int, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	return deleteDataExportArchives(ctx, bson.M{"metadata.expiresAt": bson.M{"$lte": time.Now()}})
+}
+
+func deleteDataExportArchives(ctx context.Context, filter bson.M) (int, error) {
+	bucket, err := dataExportArchives()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open data export archives: %w", err)
+	}
+
+	cursor, err := bucket.FindContext(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find data export archives: %w", err)
+	}
+	var files []gridfs.File
+	if err := cursor.All(ctx, &files); err != nil {
+		return 0, fmt.Errorf("failed to decode data export archives: %w", err)
+	}
+
+	deleted := 0
+	for _, file := range files {
+		if err := bucket.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return deleted, fmt.Errorf("failed to delete data export archive: %w", err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func FailDataExport(id primitive.ObjectID) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"status": models.DataExportFailed, "completedAt": time.Now()}}
+	if _, err := dataExportCollection.UpdateByID(ctx, id, update); err != nil {
+		return fmt.Errorf("failed to update data export: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var identityCollection *mongo.Collection = database.OpenCollection(database.Client, "identities")
+
+var ErrIdentityLinked = errors.New("identity is already linked to an account")
+
+func CreateIdentity(identity *models.Identity) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := identityCollection.InsertOne(ctx, identity); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrIdentityLinked
+		}
+		return fmt.Errorf("error creating identity: %w", err)
+	}
+	return nil
+}
+
+func GetIdentity(provider string, subject string) (*models.Identity, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	var identity models.Identity
+	err := identityCollection.FindOne(ctx, bson.M{"provider": provider, "subject": subject}).Decode(&identity)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("identity not found")
+		}
+		return nil, fmt.Errorf("failed to query identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+func GetIdentitiesByUser(userId primitive.ObjectID) ([]models.Identity, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"linkedAt": -1})
+	cursor, err := identityCollection.Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch identities: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	identities := []models.Identity{}
+	if err = cursor.All(ctx, &identities); err != nil {
+		return nil, fmt.Errorf("failed to decode identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+func DeleteIdentity(userId primitive.ObjectID, id string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := identityCollection.DeleteOne(ctx, bson.M{"_id": objID, "userId": userId})
+	if err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("identity not found")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrRequiredIndex is wrapped by EnsureIndexes when an index the service
+// cannot safely run without failed, such as the unique email index that
+// stops two accounts from sharing an address.
+var ErrRequiredIndex = errors.New("required index could not be created")
+
+// EnsureIndexes creates the indexes the queries in this package rely on.
+// It is safe to call on every start-up. Every index is attempted even when
+// others fail, and all failures are returned together.
+func EnsureIndexes() error {
+	// Creating the unique email index fails while duplicate addresses exist;
+	// those accounts have to be merged or removed by hand first.
+	required := map[*mongo.Collection][]mongo.IndexModel{
+		userCollection: {
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+	}
+
+	indexes := map[*mongo.Collection][]mongo.IndexModel{
+		userCollection: {
+			{Keys: bson.D{{Key: "deletionScheduledAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		apiKeyCollection: {
+			{Keys: bson.D{{Key: "keyHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "userId", Value: 1}}},
+		},
+		auditEventCollection: {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		},
+		dataExportCollection: {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		dataExportArchiveFiles: {
+			{Keys: bson.D{{Key: "metadata.userId", Value: 1}}},
+			{Keys: bson.D{{Key: "metadata.expiresAt", Value: 1}}},
+		},
+		loginEventCollection: {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "ip", Value: 1}, {Key: "userAgent", Value: 1}}},
+			{Keys: bson.D{{Key: "reportTokenHash", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		sessionCollection: {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		serviceAccountCollection: {
+			{Keys: bson.D{{Key: "clientId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		refreshTokenCollection: {
+			{Keys: bson.D{{Key: "tokenId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "family", Value: 1}}},
+			{Keys: bson.D{{Key: "userId", Value: 1}}},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		webauthnCredentialCollection: {
+			{Keys: bson.D{{Key: "credentialId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "userId", Value: 1}}},
+		},
+		webauthnSessionCollection: {
+			{Keys: bson.D{{Key: "sessionId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		magicLinkCollection: {
+			{Keys: bson.D{{Key: "tokenId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		oauthStateCollection: {
+			{Keys: bson.D{{Key: "state", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		otpCollection: {
+			{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "purpose", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		identityCollection: {
+			{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "userId", Value: 1}}},
+		},
+		ipAttemptCollection: {
+			{Keys: bson.D{{Key: "ip", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		rateLimitCollection: {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		revokedTokenCollection: {
+			{Keys: bson.D{{Key: "tokenId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+
+	var errs []error
+	for collection, collectionIndexes := range required {
+		for _, index := range collectionIndexes {
+			if err := createIndex(collection, index); err != nil {
+				errs = append(errs, fmt.Errorf("%w: %w", ErrRequiredIndex, err))
+			}
+		}
+	}
+	for collection, collectionIndexes := range indexes {
+		for _, index := range collectionIndexes {
+			if err := createIndex(collection, index); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// createIndex creates a single index, so one failure does not keep the
+// others in the same collection from being created.
+func createIndex(collection *mongo.Collection, index mongo.IndexModel) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to create index %v on %s: %w", index.Keys, collection.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var loginEventCollection *mongo.Collection = database.OpenCollection(database.Client, "loginEvents")
+
+func CreateLoginEvent(event *models.LoginEvent) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := loginEventCollection.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("error creating login event: %w", err)
+	}
+	return nil
+}
+
+func GetLoginEventsByUser(userId primitive.ObjectID) ([]models.LoginEvent, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := loginEventCollection.Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch login events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.LoginEvent{}
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode login events: %w", err)
+	}
+
+	return events, nil
+}
+
+// GetLoginHistory reports whether the user has signed in before at all, and
+// whether they have done so from this IP and user agent.
+func GetLoginHistory(userId primitive.ObjectID, ip string, userAgent string) (hasHistory bool, knownDevice bool, err error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	opts := options.Count().SetLimit(1)
+
+	count, err := loginEventCollection.CountDocuments(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to query login history: %w", err)
+	}
+	if count == 0 {
+		return false, false, nil
+	}
+
+	count, err = loginEventCollection.CountDocuments(ctx, bson.M{"userId": userId, "ip": ip, "userAgent": userAgent}, opts)
+	if err != nil {
+		return true, false, fmt.Errorf("failed to query login history: %w", err)
+	}
+	return true, count > 0, nil
+}
+
+// GetLoginReport returns the login event behind a "this wasn't me" link
+// while the link can still be used, without using it up.
+func GetLoginReport(tokenHash string) (*models.LoginEvent, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{
+		"reportTokenHash": tokenHash,
+		"reportedAt":      nil,
+		"reportExpiresAt": bson.M{"$gt": time.Now()},
+	}
+
+	var event models.LoginEvent
+	if err := loginEventCollection.FindOne(ctx, filter).Decode(&event); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("login event not found")
+		}
+		return nil, fmt.Errorf("failed to fetch login event: %w", err)
+	}
+
+	return &event, nil
+}
+
+// ConsumeLoginReport marks the login event behind a "this wasn't me" link as
+// reported and returns it. Each link works once and only until it expires.
+func ConsumeLoginReport(tokenHash string) (*models.LoginEvent, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"reportTokenHash": tokenHash,
+		"reportedAt":      nil,
+		"reportExpiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"reportedAt": now}}
+
+	var event models.LoginEvent
+	err := loginEventCollection.FindOneAndUpdate(ctx, filter, update).Decode(&event)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("login event not found")
+		}
+		return nil, fmt.Errorf("failed to report login: %w", err)
+	}
+
+	return &event, nil
+}
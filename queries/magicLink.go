@@ -0,0 +1,56 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var magicLinkCollection *mongo.Collection = database.OpenCollection(database.Client, "magicLinks")
+
+func CreateMagicLink(link *models.MagicLink) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := magicLinkCollection.InsertOne(ctx, link); err != nil {
+		return fmt.Errorf("error creating magic link: %w", err)
+	}
+	return nil
+}
+
+func GetMagicLink(tokenID string) (*models.MagicLink, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	var link models.MagicLink
+	err := magicLinkCollection.FindOne(ctx, bson.M{"tokenId": tokenID}).Decode(&link)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("magic link not found")
+		}
+		return nil, fmt.Errorf("failed to query magic link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// ConsumeMagicLink marks an unused magic link as used, reporting whether this
+// call was the one that used it.
+func ConsumeMagicLink(tokenID string) (bool, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"tokenId": tokenID, "usedAt": nil}
+	update := bson.M{"$set": bson.M{"usedAt": time.Now()}}
+
+	result, err := magicLinkCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume magic link: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,47 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var oauthStateCollection *mongo.Collection = database.OpenCollection(database.Client, "oauthStates")
+
+func CreateOAuthState(state *models.OAuthState) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := oauthStateCollection.InsertOne(ctx, state); err != nil {
+		return fmt.Errorf("error creating oauth state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOAuthState removes and returns the live state for provider, so each
+// state can complete at most one callback.
+func ConsumeOAuthState(state string, provider string) (*models.OAuthState, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{
+		"state":     state,
+		"provider":  provider,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+
+	var found models.OAuthState
+	if err := oauthStateCollection.FindOneAndDelete(ctx, filter).Decode(&found); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("oauth state not found")
+		}
+		return nil, fmt.Errorf("failed to consume oauth state: %w", err)
+	}
+
+	return &found, nil
+}
@@ -0,0 +1,72 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var otpCollection *mongo.Collection = database.OpenCollection(database.Client, "otps")
+
+var ErrOtpNotFound = errors.New("otp not found")
+
+// SaveOtp stores otp as the user's only live code for its purpose, replacing
+// any earlier one along with its attempt count.
+func SaveOtp(otp *models.Otp) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"userId": otp.UserID, "purpose": otp.Purpose}
+	update := bson.M{"$set": bson.M{
+		"codeHash":  otp.CodeHash,
+		"target":    otp.Target,
+		"attempts":  0,
+		"expiresAt": otp.ExpiresAt,
+		"createdAt": otp.CreatedAt,
+	}}
+
+	if _, err := otpCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to save otp: %w", err)
+	}
+	return nil
+}
+
+// AttemptOtp counts a verification attempt against the user's code for
+// purpose and returns the code as it was before this attempt, so concurrent
+// guesses can never exceed the attempt limit between them.
+func AttemptOtp(userId primitive.ObjectID, purpose string) (*models.Otp, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"userId": userId, "purpose": purpose}
+	update := bson.M{"$inc": bson.M{"attempts": 1}}
+
+	var otp models.Otp
+	if err := otpCollection.FindOneAndUpdate(ctx, filter, update).Decode(&otp); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOtpNotFound
+		}
+		return nil, fmt.Errorf("failed to record otp attempt: %w", err)
+	}
+
+	return &otp, nil
+}
+
+// ConsumeOtp deletes a code once it has been accepted, reporting whether this
+// call was the one that removed it.
+func ConsumeOtp(id primitive.ObjectID) (bool, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	result, err := otpCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, fmt.Errorf("failed to consume otp: %w", err)
+	}
+	return result.DeletedCount == 1, nil
+}
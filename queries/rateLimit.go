@@ -0,0 +1,59 @@
+package queries
+
+import (
+	"fmt"
+	"time"
+	"udo-golang/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var rateLimitCollection *mongo.Collection = database.OpenCollection(database.Client, "rateLimits")
+
+// TakeRateLimitToken refills the token bucket stored under key and takes one
+// token from it if available, all in a single atomic update. It returns the
+// tokens left and whether a token was taken. Idle buckets expire after ttl.
+func TakeRateLimitToken(key string, capacity int, ratePerSecond float64, ttl time.Duration) (float64, bool, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	now := time.Now()
+	elapsedSeconds := bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}},
+		1000,
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{
+				capacity,
+				bson.M{"$add": bson.A{
+					bson.M{"$ifNull": bson.A{"$tokens", capacity}},
+					bson.M{"$multiply": bson.A{elapsedSeconds, ratePerSecond}},
+				}},
+			}},
+			"updatedAt": now,
+			"expiresAt": now.Add(ttl),
+		}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{"tokens": bson.M{"$cond": bson.A{
+			"$allowed",
+			bson.M{"$subtract": bson.A{"$tokens", 1}},
+			"$tokens",
+		}}}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var state struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	if err := rateLimitCollection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&state); err != nil {
+		return 0, false, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return state.Tokens, state.Allowed, nil
+}
@@ -0,0 +1,98 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var refreshTokenCollection *mongo.Collection = database.OpenCollection(database.Client, "refreshTokens")
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token has already been used")
+	ErrRefreshTokenRevoked  = errors.New("refresh token has been revoked")
+)
+
+func CreateRefreshToken(token *models.RefreshToken) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := refreshTokenCollection.InsertOne(ctx, token); err != nil {
+		return fmt.Errorf("error creating refresh token: %w", err)
+	}
+	return nil
+}
+
+// ConsumeRefreshToken atomically marks an unused refresh token as used and
+// returns it. ErrRefreshTokenReused is returned, along with the stored token,
+// when the token exists but was already used, and ErrRefreshTokenRevoked when
+// it was revoked before being used.
+func ConsumeRefreshToken(tokenID string) (*models.RefreshToken, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"tokenId": tokenID, "usedAt": nil, "revokedAt": nil}
+	update := bson.M{"$set": bson.M{"usedAt": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var token models.RefreshToken
+	err := refreshTokenCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&token)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	err = refreshTokenCollection.FindOne(ctx, bson.M{"tokenId": tokenID}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to query refresh token: %w", err)
+	}
+
+	if token.UsedAt == nil {
+		return &token, ErrRefreshTokenRevoked
+	}
+	return &token, ErrRefreshTokenReused
+}
+
+func RevokeRefreshTokenFamily(family string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"family": family, "revokedAt": nil}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+
+	if _, err := refreshTokenCollection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of a user.
+func RevokeUserRefreshTokens(userID string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"userId": objID, "revokedAt": nil}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now()}}
+
+	if _, err := refreshTokenCollection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
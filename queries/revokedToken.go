@@ -0,0 +1,50 @@
+package queries
+
+import (
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var revokedTokenCollection *mongo.Collection = database.OpenCollection(database.Client, "revokedTokens")
+
+// RevokeToken adds an access token to the denylist until expiresAt.
+func RevokeToken(tokenID string, userID string, expiresAt time.Time) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"tokenId": tokenID}
+	update := bson.M{"$setOnInsert": models.RevokedToken{
+		TokenID:   tokenID,
+		UserID:    objID,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}}
+
+	_, err = revokedTokenCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func IsTokenRevoked(tokenID string) (bool, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	count, err := revokedTokenCollection.CountDocuments(ctx, bson.M{"tokenId": tokenID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,132 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var serviceAccountCollection *mongo.Collection = database.OpenCollection(database.Client, "serviceAccounts")
+
+func CreateServiceAccount(account *models.ServiceAccount) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := serviceAccountCollection.InsertOne(ctx, account); err != nil {
+		return fmt.Errorf("error creating service account: %w", err)
+	}
+	return nil
+}
+
+func GetServiceAccounts() ([]models.ServiceAccount, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := serviceAccountCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch service accounts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	accounts := []models.ServiceAccount{}
+	if err = cursor.All(ctx, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode service accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+func GetServiceAccountByID(id string) (*models.ServiceAccount, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return findServiceAccount(ctx, bson.M{"_id": objID})
+}
+
+func GetServiceAccountByClientID(clientID string) (*models.ServiceAccount, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	return findServiceAccount(ctx, bson.M{"clientId": clientID})
+}
+
+func findServiceAccount(ctx context.Context, filter bson.M) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := serviceAccountCollection.FindOne(ctx, filter).Decode(&account); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("service account not found")
+		}
+		return nil, fmt.Errorf("failed to query service account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// RotateServiceAccountSecret replaces the secret hash and bumps the token
+// version, so tokens issued under the old secret stop working.
+func RotateServiceAccountSecret(id string, secretHash string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{"secretHash": secretHash, "updatedAt": time.Now()},
+		"$inc": bson.M{"tokenVersion": 1},
+	}
+
+	result, err := serviceAccountCollection.UpdateByID(ctx, objID, update)
+	if err != nil {
+		return fmt.Errorf("failed to rotate service account secret: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("service account not found")
+	}
+	return nil
+}
+
+func DeleteServiceAccount(id string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := serviceAccountCollection.DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return fmt.Errorf("failed to delete service account: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("service account not found")
+	}
+	return nil
+}
+
+func TouchServiceAccount(id primitive.ObjectID) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := serviceAccountCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"lastUsedAt": time.Now()}}); err != nil {
+		return fmt.Errorf("failed to update service account: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var sessionCollection *mongo.Collection = database.OpenCollection(database.Client, "sessions")
+
+func CreateSession(session *models.Session) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := sessionCollection.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	return nil
+}
+
+func GetSession(id string) (*models.Session, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.Session
+	if err := sessionCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&session); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// GetActiveSessionsByUser returns the user's sessions that are neither
+// revoked nor expired, most recently used first.
+func GetActiveSessionsByUser(userId primitive.ObjectID) ([]models.Session, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{"userId": userId, "revokedAt": nil, "expiresAt": bson.M{"$gt": time.Now()}}
+	opts := options.Find().SetSort(bson.M{"lastSeenAt": -1})
+
+	cursor, err := sessionCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// GetSessionsByUser returns every stored session of the user, including
+// revoked ones.
+func GetSessionsByUser(userId primitive.ObjectID) ([]models.Session, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := sessionCollection.Find(ctx, bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+func TouchSession(id primitive.ObjectID) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"lastSeenAt": time.Now()}}
+	if _, err := sessionCollection.UpdateByID(ctx, id, update); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// ExtendSession records a refresh of the session, which now lives until
+// expiresAt.
+func ExtendSession(id string, ip string, expiresAt time.Time) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"lastSeenAt": time.Now(), "ip": ip, "expiresAt": expiresAt}}
+	if _, err := sessionCollection.UpdateByID(ctx, objID, update); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+// RevokeSession revokes one of the user's sessions along with its refresh
+// tokens.
+func RevokeSession(userId primitive.ObjectID, id string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objID, "userId": userId, "revokedAt": nil}
+	result, err := sessionCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("session not found")
+	}
+
+	return RevokeRefreshTokenFamily(id)
+}
+
+// RevokeUserSessions revokes every session of a user. Callers revoke the
+// refresh tokens themselves.
+func RevokeUserSessions(userId string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"userId": objID, "revokedAt": nil}
+	if _, err := sessionCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}}); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
@@ -2,11 +2,8 @@ package queries
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"time"
 	"udo-golang/database"
 	models "udo-golang/models"
@@ -19,6 +16,8 @@ import (
 
 var userCollection *mongo.Collection = database.OpenCollection(database.Client, "users")
 
+var ErrEmailTaken = errors.New("email is already in use")
+
 func newCtx() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), 10*time.Second)
 }
@@ -117,6 +116,116 @@ func UpdateUser(userId string, update bson.M) error {
 	return nil
 }
 
+// UpdatePassword sets a new password hash along with any fields in update,
+// moving the previous hash onto the password history. The history keeps only
+// the newest historySize hashes.
+func UpdatePassword(userId string, previousHash string, newHash string, historySize int, update bson.M) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{"password": newHash}
+	for key, value := range update {
+		set[key] = value
+	}
+
+	updateDoc := bson.M{"$set": set}
+	if previousHash != "" {
+		updateDoc["$push"] = bson.M{"passwordHistory": bson.M{
+			"$each":  bson.A{previousHash},
+			"$slice": -historySize,
+		}}
+	}
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": objID}, updateDoc)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with the given ID")
+	}
+
+	return nil
+}
+
+// RehashPassword replaces the stored password hash with newHash, a stronger
+// hash of the same password, but only while the stored hash is still
+// previousHash. A password changed in the meantime is left alone.
+func RehashPassword(userId string, previousHash string, newHash string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objID, "password": previousHash}
+	if _, err := userCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"password": newHash}}); err != nil {
+		return fmt.Errorf("failed to rehash password: %w", err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange switches the user's email to their pending email, which
+// must still be newEmail. The unique index on email makes the switch fail with
+// ErrEmailTaken if another account took the address in the meantime.
+func ConfirmEmailChange(userId string, newEmail string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objID, "pendingEmail": newEmail}
+	update := bson.M{
+		"$set":   bson.M{"email": newEmail, "isVerified": true, "updatedAt": time.Now()},
+		"$unset": bson.M{"pendingEmail": ""},
+	}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change email: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no pending email change found")
+	}
+
+	return nil
+}
+
+// IncrementTokenVersion bumps the user's token version, invalidating every
+// token issued before the call.
+func IncrementTokenVersion(userId string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return err
+	}
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$inc": bson.M{"tokenVersion": 1}})
+	if err != nil {
+		return fmt.Errorf("failed to update token version: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with the given ID")
+	}
+
+	return nil
+}
+
 func DeleteUserById(userId string) error {
 	ctx, cancel := newCtx()
 	defer cancel()
@@ -161,22 +270,50 @@ func CreateNewUser(newUser *models.User) (*mongo.InsertOneResult, error) {
 
 }
 
-func GetGoogleUserInfo(accessToken string) (map[string]interface{}, error) {
-	resp, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + accessToken)
+// ConsumeBackupCode removes a hashed MFA backup code from the user, reporting
+// whether it was present. The removal is atomic so a code works only once.
+func ConsumeBackupCode(userId string, codeHash string) (bool, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	filter := bson.M{"_id": objID, "mfaBackupCodes": codeHash}
+	update := bson.M{"$pull": bson.M{"mfaBackupCodes": codeHash}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return nil, err
+		return false, fmt.Errorf("failed to consume backup code: %w", err)
 	}
+	return result.ModifiedCount == 1, nil
+}
 
-	var userInfo map[string]interface{}
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		return nil, err
+// RecordTotpStep stores the last TOTP time step used by the user. It reports
+// false if an equal or later step was already recorded, i.e. on replay.
+func RecordTotpStep(userId string, step int64) (bool, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{
+		"_id": objID,
+		"$or": []bson.M{
+			{"mfaLastUsedStep": bson.M{"$exists": false}},
+			{"mfaLastUsedStep": bson.M{"$lt": step}},
+		},
 	}
+	update := bson.M{"$set": bson.M{"mfaLastUsedStep": step}}
 
-	return userInfo, nil
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
 }
@@ -0,0 +1,141 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"udo-golang/database"
+	models "udo-golang/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var webauthnCredentialCollection *mongo.Collection = database.OpenCollection(database.Client, "webauthnCredentials")
+var webauthnSessionCollection *mongo.Collection = database.OpenCollection(database.Client, "webauthnSessions")
+
+func CreateWebauthnCredential(credential *models.WebauthnCredential) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := webauthnCredentialCollection.InsertOne(ctx, credential); err != nil {
+		return fmt.Errorf("error creating passkey: %w", err)
+	}
+	return nil
+}
+
+func GetWebauthnCredentialsByUser(userId string) ([]models.WebauthnCredential, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	objID, err := toObjectID(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := webauthnCredentialCollection.Find(ctx, bson.M{"userId": objID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch passkeys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	credentials := []models.WebauthnCredential{}
+	if err = cursor.All(ctx, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to decode passkeys: %w", err)
+	}
+
+	return credentials, nil
+}
+
+func GetWebauthnCredentialByCredentialID(credentialID []byte) (*models.WebauthnCredential, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	var credential models.WebauthnCredential
+	err := webauthnCredentialCollection.FindOne(ctx, bson.M{"credentialId": credentialID}).Decode(&credential)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("passkey not found")
+		}
+		return nil, fmt.Errorf("failed to query passkey: %w", err)
+	}
+
+	return &credential, nil
+}
+
+// UpdateWebauthnCredentialUsage stores the authenticator state returned by a
+// successful assertion, most importantly the signature counter.
+func UpdateWebauthnCredentialUsage(credential *models.WebauthnCredential) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"credential.authenticator": credential.Credential.Authenticator,
+		"credential.flags":         credential.Credential.Flags,
+		"lastUsedAt":               time.Now(),
+	}}
+
+	if _, err := webauthnCredentialCollection.UpdateByID(ctx, credential.ID, update); err != nil {
+		return fmt.Errorf("failed to update passkey: %w", err)
+	}
+	return nil
+}
+
+func DeleteWebauthnCredential(userId string, id string) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	userObjID, err := toObjectID(userId)
+	if err != nil {
+		return err
+	}
+	objID, err := toObjectID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := webauthnCredentialCollection.DeleteOne(ctx, bson.M{"_id": objID, "userId": userObjID})
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("passkey not found")
+	}
+	return nil
+}
+
+func CreateWebauthnSession(session *models.WebauthnSession) error {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	if _, err := webauthnSessionCollection.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("error creating passkey session: %w", err)
+	}
+	return nil
+}
+
+// ConsumeWebauthnSession fetches and deletes a ceremony session in one step so
+// that each challenge can only be answered once.
+func ConsumeWebauthnSession(sessionID string, ceremony string) (*models.WebauthnSession, error) {
+	ctx, cancel := newCtx()
+	defer cancel()
+
+	filter := bson.M{
+		"sessionId": sessionID,
+		"ceremony":  ceremony,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+
+	var session models.WebauthnSession
+	err := webauthnSessionCollection.FindOneAndDelete(ctx, filter).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("passkey session not found or expired")
+		}
+		return nil, fmt.Errorf("failed to query passkey session: %w", err)
+	}
+
+	return &session, nil
+}
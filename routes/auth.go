@@ -1,21 +1,76 @@
 package routes
 
 import (
+	"time"
 	"udo-golang/controllers"
 	"udo-golang/middleware"
+	"udo-golang/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 func AuthRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.POST("auth/signup", controllers.Signup())
-	incomingRoutes.POST("auth/register", controllers.RegisterWithOtp())
-	incomingRoutes.GET("auth/google/callback", controllers.GoogleSignUpandSignIn())
-
-	incomingRoutes.POST("auth/verify-account", controllers.VerifyAccount())
-	incomingRoutes.POST("auth/resend-otp", controllers.SendOtp())
-	incomingRoutes.POST("auth/login", controllers.Login())
-	incomingRoutes.POST("auth/send-reset-otp", controllers.SendOtp())
-	incomingRoutes.POST("auth/reset-password", controllers.ResetPassword())
-	incomingRoutes.POST("auth/change-password", middleware.IsAuthenticated(), controllers.ChangePassword())
+	auth := incomingRoutes.Group("auth", middleware.RateLimiter("auth", 30, time.Minute, middleware.KeyByIP()))
+
+	// Endpoints that send mail are also limited per address so one inbox
+	// cannot be flooded from many IPs.
+	perEmail := middleware.RateLimiter("auth-email", 5, 15*time.Minute, middleware.KeyByField("email"))
+	perNewEmail := middleware.RateLimiter("auth-email", 5, 15*time.Minute, middleware.KeyByField("newEmail"))
+
+	// Account and credential management is only open to the user's own
+	// session, never to API keys.
+	account := auth.Group("", middleware.IsAuthenticated(), middleware.RequireSession())
+
+	// Support staff impersonating a user must not touch their credentials.
+	noImpersonation := middleware.ForbidImpersonation()
+
+	auth.POST("signup", controllers.Signup())
+	auth.POST("register", perEmail, controllers.RegisterWithOtp())
+	auth.POST("google/callback", controllers.GoogleSignUpandSignIn())
+	auth.GET(":provider/start", controllers.OAuthStart())
+	auth.GET(":provider/callback", controllers.OAuthCallback())
+	auth.POST(":provider/callback", controllers.OAuthCallback())
+
+	auth.POST("verify-account", controllers.VerifyAccount())
+	auth.POST("resend-otp", perEmail, controllers.SendOtp(models.OtpPurposeVerify))
+	auth.POST("login", controllers.Login())
+	auth.POST("login/mfa", controllers.LoginMfa())
+	auth.POST("magic-link", perEmail, controllers.SendMagicLink())
+	auth.GET("magic-link/verify", controllers.VerifyMagicLink())
+	auth.GET("login-report", controllers.ShowLoginReport())
+	auth.POST("login-report", controllers.ReportLogin())
+	auth.POST("refresh", controllers.RefreshToken())
+	auth.POST("token", controllers.ServiceToken())
+	account.POST("logout", controllers.Logout())
+	account.POST("logout-all", noImpersonation, controllers.LogoutAll())
+	account.GET("sessions", controllers.GetSessions())
+	account.DELETE("sessions/:id", noImpersonation, controllers.RevokeSession())
+	auth.POST("send-reset-otp", perEmail, controllers.SendOtp(models.OtpPurposeReset))
+	auth.POST("reset-password", controllers.ResetPassword())
+	account.POST("change-password", noImpersonation, controllers.ChangePassword())
+	account.POST("change-email", noImpersonation, perNewEmail, controllers.RequestEmailChange())
+	account.POST("change-email/confirm", noImpersonation, controllers.ConfirmEmailChange())
+	account.POST("delete-account", noImpersonation, controllers.DeleteAccount())
+
+	account.POST("data-exports", noImpersonation, controllers.RequestDataExport())
+	account.GET("data-exports/:id", noImpersonation, controllers.GetDataExport())
+	auth.GET("data-exports/:id/download", controllers.DownloadDataExport())
+
+	account.POST("mfa/enroll", noImpersonation, controllers.EnrollMfa())
+	account.POST("mfa/confirm", noImpersonation, controllers.ConfirmMfa())
+
+	account.POST("passkeys/register/begin", noImpersonation, controllers.BeginPasskeyRegistration())
+	account.POST("passkeys/register/finish", noImpersonation, controllers.FinishPasskeyRegistration())
+	auth.POST("passkeys/login/begin", controllers.BeginPasskeyLogin())
+	auth.POST("passkeys/login/finish", controllers.FinishPasskeyLogin())
+	account.GET("passkeys", controllers.GetPasskeys())
+	account.DELETE("passkeys/:id", noImpersonation, controllers.DeletePasskey())
+
+	account.GET("identities", controllers.GetIdentities())
+	account.POST("identities/:provider", noImpersonation, controllers.LinkIdentity())
+	account.DELETE("identities/:id", noImpersonation, controllers.UnlinkIdentity())
+
+	account.POST("api-keys", noImpersonation, controllers.CreateAPIKey())
+	account.GET("api-keys", controllers.GetAPIKeys())
+	account.DELETE("api-keys/:id", noImpersonation, controllers.RevokeAPIKey())
 }
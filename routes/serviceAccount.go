@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"time"
+	"udo-golang/controllers"
+	"udo-golang/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ServiceAccountRoutes(incomingRoutes *gin.Engine) {
+	// Only an admin's own session manages service accounts; neither API keys
+	// nor service accounts can create more credentials.
+	serviceAccounts := incomingRoutes.Group("service-accounts",
+		middleware.RateLimiter("service-accounts", 60, time.Minute, middleware.KeyByUser()),
+		middleware.IsAdmin(),
+		middleware.RequireSession(),
+	)
+
+	serviceAccounts.POST("", controllers.CreateServiceAccount())
+	serviceAccounts.GET("", controllers.GetServiceAccounts())
+	serviceAccounts.POST(":id/secret", controllers.RotateServiceAccountSecret())
+	serviceAccounts.DELETE(":id", controllers.DeleteServiceAccount())
+}
@@ -1,15 +1,27 @@
 package routes
 
 import (
+	"time"
 	"udo-golang/controllers"
+	"udo-golang/helpers"
 	"udo-golang/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 func UserRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("users", middleware.IsAdmin(), controllers.GetAllUsers())
-	incomingRoutes.GET("users/:id", controllers.GetUser())
-	incomingRoutes.DELETE("delete-user/:id", middleware.IsAdmin(), controllers.DeleteUser())
-	incomingRoutes.PUT("update-user/:id", controllers.UpdateUser())
+	users := incomingRoutes.Group("", middleware.RateLimiter("users", 120, time.Minute, middleware.KeyByUser()))
+
+	users.GET("users", middleware.IsAdmin(), middleware.RequireScope(helpers.ScopeUsersRead), controllers.GetAllUsers())
+	users.GET("users/:id", controllers.GetUser())
+	users.GET("users/:id/sessions", middleware.IsAdmin(), middleware.RequireScope(helpers.ScopeUsersRead), controllers.GetUserSessions())
+	users.DELETE("users/:id/sessions/:sessionId", middleware.IsAdmin(), middleware.RequireScope(helpers.ScopeUsersWrite), controllers.RevokeUserSession())
+	users.DELETE("delete-user/:id", middleware.IsAdmin(), middleware.RequireScope(helpers.ScopeUsersWrite), middleware.ForbidImpersonation(), controllers.DeleteUser())
+	users.PUT("update-user/:id", middleware.IsAdmin(), middleware.RequireScope(helpers.ScopeUsersWrite), middleware.ForbidImpersonation(), controllers.UpdateUser())
+	users.POST("unlock-user/:id", middleware.IsAdmin(), middleware.RequireScope(helpers.ScopeUsersWrite), middleware.ForbidImpersonation(), controllers.UnlockUser())
+
+	users.POST("impersonate/:id", middleware.IsAdmin(), middleware.RequireSession(), controllers.ImpersonateUser())
+	users.GET("audit-events", middleware.IsAdmin(), middleware.RequireSession(), controllers.GetAuditEvents())
+	users.POST("users/:id/data-exports", middleware.IsAdmin(), middleware.RequireSession(), controllers.RequestUserDataExport())
+	users.GET("users/:id/data-exports/:exportId", middleware.IsAdmin(), middleware.RequireSession(), controllers.GetUserDataExport())
 }
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"udo-golang/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WellKnownRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET(".well-known/jwks.json", controllers.JWKS())
+}